@@ -0,0 +1,117 @@
+// Package backoff 计算两次重试(或重启)之间的等待时长
+// 等待时长按指数增长 并可以叠加随机抖动 避免大量goroutine在同一时刻重试
+package backoff
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Jitter 随机抖动的方式
+type Jitter int
+
+const (
+	// NoJitter 不叠加抖动 等待时长为Initial * Multiplier^n
+	NoJitter Jitter = iota
+	// FullJitter 等待时长为[0, Initial * Multiplier^n]之间的随机值
+	FullJitter
+	// DecorrelatedJitter 等待时长为[Initial, 上一次等待时长 * 3]之间的随机值 与重试次数无关
+	DecorrelatedJitter
+)
+
+// Policy 退避策略
+type Policy struct {
+	Initial    time.Duration // 第一次的等待时长
+	Multiplier float64       // 每次等待时长相对上一次的倍数 小于等于1时使用2
+	Max        time.Duration // 等待时长的上限 为0时表示不设上限
+	Jitter     Jitter
+}
+
+// Backoff 按Policy依次生成等待时长 Backoff不是并发安全的
+type Backoff struct {
+	policy  Policy
+	rand    *rand.Rand
+	attempt int
+	prev    time.Duration // 上一次的等待时长 仅DecorrelatedJitter使用
+}
+
+// New 创建一个Backoff r用于生成抖动 为nil时使用math/rand的全局随机数生成器
+func New(policy Policy, r *rand.Rand) *Backoff {
+	if policy.Multiplier <= 1 {
+		policy.Multiplier = 2
+	}
+	return &Backoff{policy: policy, rand: r}
+}
+
+// Next 返回下一次的等待时长
+func (b *Backoff) Next() time.Duration {
+	defer func() { b.attempt++ }()
+
+	switch b.policy.Jitter {
+	case FullJitter:
+		return b.between(0, b.exponential())
+	case DecorrelatedJitter:
+		prev := b.prev
+		if prev < b.policy.Initial {
+			prev = b.policy.Initial
+		}
+		upper := time.Duration(math.MaxInt64)
+		// 3*prev会超出int64范围时以MaxInt64为上界
+		if prev <= upper/3 {
+			upper = 3 * prev
+		}
+		b.prev = b.capped(b.between(b.policy.Initial, upper))
+		return b.prev
+	default:
+		return b.exponential()
+	}
+}
+
+// Reset 将Backoff恢复到初始状态 下一次调用Next将返回第一次的等待时长
+func (b *Backoff) Reset() {
+	b.attempt = 0
+	b.prev = 0
+}
+
+// Attempt 返回自上次Reset以来调用Next的次数
+func (b *Backoff) Attempt() int {
+	return b.attempt
+}
+
+// exponential 返回未叠加抖动时第attempt次的等待时长
+func (b *Backoff) exponential() time.Duration {
+	d := float64(b.policy.Initial) * math.Pow(b.policy.Multiplier, float64(b.attempt))
+	// 超出int64范围时同样视为达到上限
+	if d >= math.MaxInt64 {
+		if b.policy.Max > 0 {
+			return b.policy.Max
+		}
+		return time.Duration(math.MaxInt64)
+	}
+	return b.capped(time.Duration(d))
+}
+
+func (b *Backoff) capped(d time.Duration) time.Duration {
+	if b.policy.Max > 0 && d > b.policy.Max {
+		return b.policy.Max
+	}
+	return d
+}
+
+// between 返回[min, max]之间的随机时长
+func (b *Backoff) between(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+
+	// max-min为MaxInt64时再加1会溢出为负数 此时取[min, max)
+	n := int64(max - min)
+	if n < math.MaxInt64 {
+		n++
+	}
+	if b.rand != nil {
+		return min + time.Duration(b.rand.Int63n(n))
+	}
+	return min + time.Duration(rand.Int63n(n))
+}
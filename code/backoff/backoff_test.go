@@ -0,0 +1,91 @@
+package backoff
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestBackoff_ExponentialWithCap(t *testing.T) {
+	b := New(Policy{Initial: time.Second, Multiplier: 2, Max: 10 * time.Second}, nil)
+
+	expected := []time.Duration{1, 2, 4, 8, 10, 10}
+	for i, e := range expected {
+		if d := b.Next(); d != e*time.Second {
+			t.Errorf("attempt %v: expected %v, but received %v", i, e*time.Second, d)
+		}
+	}
+}
+
+func TestBackoff_ResetStartsOver(t *testing.T) {
+	b := New(Policy{Initial: time.Second, Multiplier: 3}, nil)
+	b.Next()
+	b.Next()
+
+	b.Reset()
+	if d := b.Next(); d != time.Second {
+		t.Errorf("expected %v after reset, but received %v", time.Second, d)
+	}
+	if b.Attempt() != 1 {
+		t.Errorf("expected attempt 1, but received %v", b.Attempt())
+	}
+}
+
+func TestBackoff_FullJitterStaysWithinExponential(t *testing.T) {
+	b := New(Policy{Initial: time.Second, Multiplier: 2, Max: 8 * time.Second, Jitter: FullJitter}, rand.New(rand.NewSource(1)))
+
+	for i := 0; i < 100; i++ {
+		upper := time.Second << uint(i)
+		if upper > 8*time.Second || upper <= 0 {
+			upper = 8 * time.Second
+		}
+
+		if d := b.Next(); d < 0 || d > upper {
+			t.Fatalf("attempt %v: expected value in [0, %v], but received %v", i, upper, d)
+		}
+	}
+}
+
+func TestBackoff_DecorrelatedJitterStaysWithinBounds(t *testing.T) {
+	policy := Policy{Initial: 100 * time.Millisecond, Max: 5 * time.Second, Jitter: DecorrelatedJitter}
+	b := New(policy, rand.New(rand.NewSource(1)))
+
+	prev := policy.Initial
+	for i := 0; i < 100; i++ {
+		upper := 3 * prev
+		if upper > policy.Max {
+			upper = policy.Max
+		}
+
+		d := b.Next()
+		if d < policy.Initial || d > upper {
+			t.Fatalf("attempt %v: expected value in [%v, %v], but received %v", i, policy.Initial, upper, d)
+		}
+		prev = d
+	}
+}
+
+func TestBackoff_SameSeedSameSequence(t *testing.T) {
+	policy := Policy{Initial: time.Second, Max: time.Minute, Jitter: DecorrelatedJitter}
+	b1 := New(policy, rand.New(rand.NewSource(42)))
+	b2 := New(policy, rand.New(rand.NewSource(42)))
+
+	for i := 0; i < 10; i++ {
+		if d1, d2 := b1.Next(), b2.Next(); d1 != d2 {
+			t.Fatalf("attempt %v: expected identical sequences, but received %v and %v", i, d1, d2)
+		}
+	}
+}
+
+func TestBackoff_UncappedJitterDoesNotOverflow(t *testing.T) {
+	for _, jitter := range []Jitter{NoJitter, FullJitter, DecorrelatedJitter} {
+		b := New(Policy{Initial: time.Second, Multiplier: 2, Jitter: jitter}, rand.New(rand.NewSource(1)))
+
+		// 约第34次之后Initial * 2^n超出int64范围
+		for i := 0; i < 200; i++ {
+			if d := b.Next(); d < 0 {
+				t.Fatalf("jitter %v attempt %v: expected non-negative value, but received %v", jitter, i, d)
+			}
+		}
+	}
+}
@@ -0,0 +1,264 @@
+// Package breaker 熔断器 下游持续失败时快速拒绝请求 冷却后放行少量探测请求 探测成功后恢复
+// Breaker.Wait与multiLimiterI.RateLimiter.Wait形式相同 因此可以通过Chain放在限速器之前
+// 通过Ward与supervisor组合 熔断器打开期间不启动依赖下游的ward
+package breaker
+
+import (
+	"code/clock"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrOpen 熔断器处于Open状态 请求被拒绝
+	ErrOpen = errors.New("breaker: circuit open")
+	// ErrTooManyProbes 熔断器处于HalfOpen状态 且探测请求数已达上限
+	ErrTooManyProbes = errors.New("breaker: too many half-open probes")
+)
+
+// State 熔断器的状态
+type State int
+
+const (
+	// Closed 正常放行请求 并统计失败
+	Closed State = iota
+	// Open 拒绝所有请求 直到冷却结束
+	Open
+	// HalfOpen 放行有限个探测请求 全部成功则进入Closed 任意一个失败则重新进入Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "Closed"
+	case Open:
+		return "Open"
+	case HalfOpen:
+		return "HalfOpen"
+	default:
+		return "Unknown"
+	}
+}
+
+type Config struct {
+	// ConsecutiveFailures 连续失败多少次后熔断 <=0表示不按连续失败熔断
+	ConsecutiveFailures int
+	// FailureRatio 一个统计窗口内失败的比例达到该值后熔断 <=0表示不按失败比例熔断
+	FailureRatio float64
+	// MinRequests 统计窗口内的请求数至少达到该值才按失败比例熔断 <=0时为10
+	MinRequests int
+	// Window 统计窗口的长度 每个窗口结束时清零计数 <=0时为10s
+	Window time.Duration
+	// CoolDown 从Open进入HalfOpen之前等待的时长 <=0时为5s
+	CoolDown time.Duration
+	// MaxProbes HalfOpen状态下最多同时放行的探测请求数 也是恢复为Closed所需的连续成功次数 <=0时为1
+	MaxProbes int
+	// IsFailure 判断Done收到的错误是否算作失败 为nil时所有非nil的错误都算作失败
+	IsFailure func(err error) bool
+	// OnStateChange 状态变化时被调用 调用时不持有熔断器的锁
+	OnStateChange func(from, to State)
+	// Clock 为nil时使用真实时钟
+	Clock clock.Clock
+}
+
+// Breaker 熔断器 调用方在发出请求前调用Wait 请求完成后调用Done报告结果
+// Wait成功但最终没有发出请求时(例如之后的限速器等待失败) 调用Cancel归还探测名额
+// Done和Cancel不区分对应的是哪一次Wait 因此状态变化前放行的请求 其结果可能被计入变化后的状态
+type Breaker struct {
+	config Config
+	clk    clock.Clock
+
+	mu     sync.Mutex
+	state  State
+	opened time.Time
+	// windowStart 当前统计窗口的开始时刻
+	windowStart time.Time
+	requests    int
+	failures    int
+	consecutive int
+	// probes HalfOpen状态下正在进行的探测请求数 successes为HalfOpen状态下的连续成功次数
+	probes    int
+	successes int
+}
+
+func New(config Config) *Breaker {
+	if config.MinRequests <= 0 {
+		config.MinRequests = 10
+	}
+	if config.Window <= 0 {
+		config.Window = 10 * time.Second
+	}
+	if config.CoolDown <= 0 {
+		config.CoolDown = 5 * time.Second
+	}
+	if config.MaxProbes <= 0 {
+		config.MaxProbes = 1
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = func(err error) bool { return err != nil }
+	}
+
+	clk := clock.OrReal(config.Clock)
+	return &Breaker{config: config, clk: clk, windowStart: clk.Now()}
+}
+
+// State 当前的状态 冷却已经结束的Open状态报告为HalfOpen
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	state, change := b.advanceLocked(b.clk.Now())
+	b.mu.Unlock()
+
+	b.notify(change)
+	return state
+}
+
+// Wait 判断是否放行请求 不会阻塞 Open时返回ErrOpen HalfOpen且探测名额已满时返回ErrTooManyProbes
+func (b *Breaker) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	state, change := b.advanceLocked(b.clk.Now())
+
+	var err error
+	switch state {
+	case Open:
+		err = ErrOpen
+	case HalfOpen:
+		if b.probes >= b.config.MaxProbes {
+			err = ErrTooManyProbes
+		} else {
+			b.probes++
+		}
+	}
+	b.mu.Unlock()
+
+	b.notify(change)
+	return err
+}
+
+// Done 报告一个被放行的请求的结果
+func (b *Breaker) Done(err error) {
+	failed := b.config.IsFailure(err)
+	now := b.clk.Now()
+
+	b.mu.Lock()
+	state, change := b.advanceLocked(now)
+
+	switch state {
+	case Closed:
+		b.rollWindowLocked(now)
+		b.requests++
+		if failed {
+			b.failures++
+			b.consecutive++
+		} else {
+			b.consecutive = 0
+		}
+
+		if b.shouldTripLocked() {
+			change = b.setStateLocked(Open, now)
+		}
+	case HalfOpen:
+		if b.probes > 0 {
+			b.probes--
+		}
+		if failed {
+			change = b.setStateLocked(Open, now)
+			break
+		}
+
+		b.successes++
+		if b.successes >= b.config.MaxProbes {
+			change = b.setStateLocked(Closed, now)
+		}
+	}
+	b.mu.Unlock()
+
+	b.notify(change)
+}
+
+// Cancel 被放行的请求最终没有发出 归还HalfOpen状态下的探测名额 不影响统计
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == HalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// Do 在熔断器的保护下调用fn
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := b.Wait(ctx); err != nil {
+		return err
+	}
+
+	err := fn(ctx)
+	b.Done(err)
+	return err
+}
+
+func (b *Breaker) shouldTripLocked() bool {
+	if b.config.ConsecutiveFailures > 0 && b.consecutive >= b.config.ConsecutiveFailures {
+		return true
+	}
+
+	return b.config.FailureRatio > 0 &&
+		b.requests >= b.config.MinRequests &&
+		float64(b.failures)/float64(b.requests) >= b.config.FailureRatio
+}
+
+// rollWindowLocked 当前统计窗口已经结束时开始新的窗口 连续失败次数跨窗口累计
+func (b *Breaker) rollWindowLocked(now time.Time) {
+	if now.Sub(b.windowStart) < b.config.Window {
+		return
+	}
+
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+}
+
+// advanceLocked Open状态冷却结束后进入HalfOpen
+func (b *Breaker) advanceLocked(now time.Time) (State, *stateChange) {
+	if b.state == Open && now.Sub(b.opened) >= b.config.CoolDown {
+		return HalfOpen, b.setStateLocked(HalfOpen, now)
+	}
+
+	return b.state, nil
+}
+
+type stateChange struct {
+	from, to State
+}
+
+func (b *Breaker) setStateLocked(state State, now time.Time) *stateChange {
+	change := &stateChange{from: b.state, to: state}
+	b.state = state
+
+	switch state {
+	case Open:
+		b.opened = now
+	case HalfOpen:
+		b.probes = 0
+		b.successes = 0
+	case Closed:
+		b.windowStart = now
+		b.requests = 0
+		b.failures = 0
+		b.consecutive = 0
+	}
+
+	return change
+}
+
+func (b *Breaker) notify(change *stateChange) {
+	if change != nil && b.config.OnStateChange != nil {
+		b.config.OnStateChange(change.from, change.to)
+	}
+}
@@ -0,0 +1,189 @@
+package breaker
+
+import (
+	"code/chapter5/21-tieredMultiLimiter/multiLimiter"
+	"code/clock"
+	"context"
+	"errors"
+	"golang.org/x/time/rate"
+	"testing"
+	"time"
+)
+
+var errBadHost = errors.New("dial tcp: lookup badHostFoo: no such host")
+
+func newFake() *clock.Fake {
+	return clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+}
+
+// call 在熔断器的保护下模拟一次请求 返回Wait的错误
+func call(b *Breaker, err error) error {
+	if waitErr := b.Wait(context.Background()); waitErr != nil {
+		return waitErr
+	}
+
+	b.Done(err)
+	return nil
+}
+
+func TestBreaker_ConsecutiveFailuresTrip(t *testing.T) {
+	b := New(Config{ConsecutiveFailures: 3, Clock: newFake()})
+
+	call(b, errBadHost)
+	call(b, errBadHost)
+	call(b, nil)
+	call(b, errBadHost)
+	call(b, errBadHost)
+	if b.State() != Closed {
+		t.Errorf("expected %v, but received %v", Closed, b.State())
+	}
+
+	call(b, errBadHost)
+	if b.State() != Open {
+		t.Errorf("expected %v, but received %v", Open, b.State())
+	}
+
+	if err := b.Wait(context.Background()); !errors.Is(err, ErrOpen) {
+		t.Errorf("expected %v, but received %v", ErrOpen, err)
+	}
+}
+
+func TestBreaker_FailureRatioTrip(t *testing.T) {
+	clk := newFake()
+	b := New(Config{FailureRatio: 0.5, MinRequests: 4, Window: time.Second, Clock: clk})
+
+	// 请求数未达到MinRequests时不熔断
+	call(b, errBadHost)
+	call(b, errBadHost)
+	call(b, nil)
+	if b.State() != Closed {
+		t.Errorf("expected %v, but received %v", Closed, b.State())
+	}
+
+	// 新窗口清零计数
+	clk.Advance(time.Second)
+	call(b, errBadHost)
+	call(b, nil)
+	call(b, nil)
+	if b.State() != Closed {
+		t.Errorf("expected %v, but received %v", Closed, b.State())
+	}
+
+	call(b, errBadHost)
+	if b.State() != Open {
+		t.Errorf("expected %v, but received %v", Open, b.State())
+	}
+}
+
+func TestBreaker_HalfOpenProbes(t *testing.T) {
+	clk := newFake()
+	var changes []State
+	b := New(Config{
+		ConsecutiveFailures: 1,
+		CoolDown:            5 * time.Second,
+		MaxProbes:           2,
+		OnStateChange:       func(from, to State) { changes = append(changes, to) },
+		Clock:               clk,
+	})
+
+	call(b, errBadHost)
+	clk.Advance(4 * time.Second)
+	if err := b.Wait(context.Background()); !errors.Is(err, ErrOpen) {
+		t.Errorf("expected %v, but received %v", ErrOpen, err)
+	}
+
+	// 冷却结束后最多放行MaxProbes个探测请求
+	clk.Advance(time.Second)
+	for i := 0; i < 2; i++ {
+		if err := b.Wait(context.Background()); err != nil {
+			t.Fatalf("expected probe %v to be admitted, but received %v", i, err)
+		}
+	}
+	if err := b.Wait(context.Background()); !errors.Is(err, ErrTooManyProbes) {
+		t.Errorf("expected %v, but received %v", ErrTooManyProbes, err)
+	}
+
+	// 被取消的探测请求归还名额
+	b.Cancel()
+	if err := b.Wait(context.Background()); err != nil {
+		t.Errorf("expected probe to be admitted after cancel, but received %v", err)
+	}
+
+	b.Done(nil)
+	if b.State() != HalfOpen {
+		t.Errorf("expected %v, but received %v", HalfOpen, b.State())
+	}
+	b.Done(nil)
+	if b.State() != Closed {
+		t.Errorf("expected %v, but received %v", Closed, b.State())
+	}
+
+	expected := []State{Open, HalfOpen, Closed}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %v, but received %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("expected %v, but received %v", expected, changes)
+		}
+	}
+}
+
+func TestBreaker_FailedProbeReopens(t *testing.T) {
+	clk := newFake()
+	b := New(Config{ConsecutiveFailures: 1, CoolDown: 5 * time.Second, Clock: clk})
+
+	call(b, errBadHost)
+	clk.Advance(5 * time.Second)
+	if err := call(b, errBadHost); err != nil {
+		t.Fatalf("expected probe to be admitted, but received %v", err)
+	}
+	if b.State() != Open {
+		t.Errorf("expected %v, but received %v", Open, b.State())
+	}
+
+	// 重新打开后再次完整冷却
+	clk.Advance(4 * time.Second)
+	if err := b.Wait(context.Background()); !errors.Is(err, ErrOpen) {
+		t.Errorf("expected %v, but received %v", ErrOpen, err)
+	}
+}
+
+func TestBreaker_IsFailure(t *testing.T) {
+	b := New(Config{
+		ConsecutiveFailures: 1,
+		IsFailure:           func(err error) bool { return err != nil && !errors.Is(err, context.Canceled) },
+		Clock:               newFake(),
+	})
+
+	call(b, context.Canceled)
+	if b.State() != Closed {
+		t.Errorf("expected %v, but received %v", Closed, b.State())
+	}
+}
+
+func TestChain_OpenBreakerDoesNotConsumeTokens(t *testing.T) {
+	clk := newFake()
+	b := New(Config{ConsecutiveFailures: 1, CoolDown: 5 * time.Second, MaxProbes: 1, Clock: clk})
+	limiter := multiLimiter.NewMultiLimiter(multiLimiter.NewLimiter(rate.Every(time.Hour), 1))
+	waiter := Chain(b, limiter)
+
+	call(b, errBadHost)
+	if err := waiter.Wait(context.Background()); !errors.Is(err, ErrOpen) {
+		t.Errorf("expected %v, but received %v", ErrOpen, err)
+	}
+	if !limiter.Allow() {
+		t.Errorf("expected open breaker not to consume the limiter's token")
+	}
+
+	// 限速器等待失败时 探测名额被归还
+	clk.Advance(5 * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := waiter.Wait(ctx); err == nil {
+		t.Fatalf("expected limiter wait to fail")
+	}
+	if err := b.Wait(context.Background()); err != nil {
+		t.Errorf("expected probe slot to be released, but received %v", err)
+	}
+}
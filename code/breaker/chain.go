@@ -0,0 +1,40 @@
+package breaker
+
+import "context"
+
+// Waiter 与multiLimiterI.RateLimiter.Wait形式相同的等待者 *multiLimiter.MultiLimiter和*Breaker都满足该接口
+type Waiter interface {
+	Wait(ctx context.Context) error
+}
+
+// Chain 返回先经过熔断器 再等待next的Waiter
+// 熔断器打开时快速失败 不会消耗next中的令牌 next等待失败时归还熔断器的探测名额
+// 请求完成后 调用方仍需调用b.Done报告结果
+func Chain(b *Breaker, next Waiter) Waiter {
+	return chain{breaker: b, next: next}
+}
+
+type chain struct {
+	breaker *Breaker
+	next    Waiter
+}
+
+func (c chain) Wait(ctx context.Context) error {
+	if err := c.breaker.Wait(ctx); err != nil {
+		return err
+	}
+
+	if err := c.next.Wait(ctx); err != nil {
+		c.breaker.Cancel()
+		return err
+	}
+
+	return nil
+}
+
+// WaiterFunc 将普通函数适配为Waiter
+type WaiterFunc func(ctx context.Context) error
+
+func (f WaiterFunc) Wait(ctx context.Context) error {
+	return f(ctx)
+}
@@ -0,0 +1,54 @@
+package breaker
+
+import (
+	"code/supervisor"
+	"time"
+)
+
+// Ward 返回在熔断器打开期间不启动ward的StartGoroutineFn 用于使用下游服务的ward
+// 下游持续失败时 ward崩溃后会被Supervisor立即重启 重启后的ward只会再次失败 并且加重下游的负担
+// 熔断器处于Open状态时 返回的goroutine代替ward发送心跳 直到冷却结束才启动ward 之后转发ward的心跳
+// ward应通过b调用下游 使熔断器能够统计下游的失败
+func Ward(b *Breaker, start supervisor.StartGoroutineFn) supervisor.StartGoroutineFn {
+	return func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
+		heartbeat := make(chan interface{})
+
+		go func() {
+			defer close(heartbeat)
+
+			if !waitClosed(b, done, pulseInterval, heartbeat) {
+				return
+			}
+
+			for pulse := range start(done, pulseInterval) {
+				select {
+				case heartbeat <- pulse:
+				case <-done:
+					return
+				}
+			}
+		}()
+
+		return heartbeat
+	}
+}
+
+// waitClosed 熔断器处于Open状态期间每隔pulseInterval发送一次心跳 done被关闭时返回false
+func waitClosed(b *Breaker, done <-chan interface{}, pulseInterval time.Duration, heartbeat chan<- interface{}) bool {
+	pulse := b.clk.NewTicker(pulseInterval)
+	defer pulse.Stop()
+
+	for b.State() == Open {
+		select {
+		case <-pulse.C():
+			select {
+			case heartbeat <- struct{}{}:
+			default:
+			}
+		case <-done:
+			return false
+		}
+	}
+
+	return true
+}
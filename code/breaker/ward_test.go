@@ -0,0 +1,51 @@
+package breaker
+
+import (
+	"code/supervisor"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWard_NotRestartedWhileBreakerIsOpen(t *testing.T) {
+	b := New(Config{ConsecutiveFailures: 1, CoolDown: 200 * time.Millisecond})
+
+	// 每次启动都调用一次下游 下游总是失败 ward随即退出
+	var starts atomic.Int32
+	client := func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
+		starts.Add(1)
+		heartbeat := make(chan interface{})
+		go func() {
+			defer close(heartbeat)
+			b.Do(context.Background(), func(ctx context.Context) error {
+				return errBadHost
+			})
+		}()
+		return heartbeat
+	}
+
+	s := supervisor.NewSupervisor(supervisor.Config{
+		Strategy:    supervisor.OneForOne,
+		MaxRestarts: 5,
+		Window:      time.Second,
+		Children:    []supervisor.ChildSpec{{Name: "client", Start: Ward(b, client), Timeout: 20 * time.Millisecond}},
+	})
+	events, cancel := s.Subscribe(100)
+	defer cancel()
+
+	done := make(chan interface{})
+	s.Start(done, 10*time.Millisecond)
+	time.Sleep(300 * time.Millisecond)
+	close(done)
+
+	// 第1次启动使熔断器打开 冷却结束后的第2次启动作为探测再次失败 熔断器重新打开
+	if n := starts.Load(); n != 2 {
+		t.Errorf("expected %v, but received %v", 2, n)
+	}
+	for len(events) > 0 {
+		if event := <-events; event.Kind == supervisor.WardGaveUp || event.Reason == "heartbeat missed" {
+			t.Errorf("expected the waiting ward to stay healthy, but received %v: %v", event.Kind, event.Reason)
+		}
+	}
+}
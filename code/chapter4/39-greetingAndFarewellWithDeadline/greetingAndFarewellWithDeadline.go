@@ -1,6 +1,7 @@
 package main
 
 import (
+	"code/clock"
 	"context"
 	"fmt"
 	"sync"
@@ -8,6 +9,7 @@ import (
 )
 
 func main() {
+	clk := clock.Real{}
 	var wg sync.WaitGroup
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -15,7 +17,7 @@ func main() {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := printGreeting(ctx); err != nil {
+		if err := printGreeting(ctx, clk); err != nil {
 			fmt.Printf("can not print greeting: %v\n", err)
 			cancel()
 		}
@@ -24,7 +26,7 @@ func main() {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := printFarewell(ctx); err != nil {
+		if err := printFarewell(ctx, clk); err != nil {
 			fmt.Printf("can not print farewell: %v\n", err)
 		}
 	}()
@@ -32,8 +34,8 @@ func main() {
 	wg.Wait()
 }
 
-func printGreeting(ctx context.Context) error {
-	greeting, err := genGreeting(ctx)
+func printGreeting(ctx context.Context, clk clock.Clock) error {
+	greeting, err := genGreeting(ctx, clk)
 	if err != nil {
 		return err
 	}
@@ -41,11 +43,12 @@ func printGreeting(ctx context.Context) error {
 	return nil
 }
 
-func genGreeting(ctx context.Context) (string, error) {
-	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+func genGreeting(ctx context.Context, clk clock.Clock) (string, error) {
+	// 使用clk计算deadline 使locale中的deadline检查与clk处于同一时间线
+	ctx, cancel := context.WithDeadline(ctx, clk.Now().Add(1*time.Second))
 	defer cancel()
 
-	switch language, err := locale(ctx); {
+	switch language, err := locale(ctx, clk); {
 	case err != nil:
 		return "", err
 	case language == "EN/US":
@@ -54,8 +57,8 @@ func genGreeting(ctx context.Context) (string, error) {
 	return "", fmt.Errorf("unsupported language")
 }
 
-func printFarewell(ctx context.Context) error {
-	farewell, err := genFarewell(ctx)
+func printFarewell(ctx context.Context, clk clock.Clock) error {
+	farewell, err := genFarewell(ctx, clk)
 	if err != nil {
 		return err
 	}
@@ -63,8 +66,8 @@ func printFarewell(ctx context.Context) error {
 	return nil
 }
 
-func genFarewell(ctx context.Context) (string, error) {
-	switch language, err := locale(ctx); {
+func genFarewell(ctx context.Context, clk clock.Clock) (string, error) {
+	switch language, err := locale(ctx, clk); {
 	case err != nil:
 		return "", err
 	case language == "EN/US":
@@ -73,11 +76,11 @@ func genFarewell(ctx context.Context) (string, error) {
 	return "", fmt.Errorf("unsupported language")
 }
 
-func locale(ctx context.Context) (string, error) {
+func locale(ctx context.Context, clk clock.Clock) (string, error) {
 	if deadline, ok := ctx.Deadline(); ok {
 		// 预计运行完毕时刻 = 当前时刻 + 1分钟
 		// deadline时刻 - (预计运行完毕时刻) <= 0 意味着会超时 则不运行
-		if deadline.Sub(time.Now().Add(1*time.Minute)) <= 0 {
+		if deadline.Sub(clk.Now().Add(1*time.Minute)) <= 0 {
 			return "", context.DeadlineExceeded
 		}
 	}
@@ -85,7 +88,7 @@ func locale(ctx context.Context) (string, error) {
 	select {
 	case <-ctx.Done():
 		return "", ctx.Err()
-	case <-time.After(1 * time.Minute):
+	case <-clk.After(1 * time.Minute):
 	}
 	return "EN/US", nil
 }
@@ -0,0 +1,46 @@
+package customError
+
+// Class 错误的分类 决定该错误是否值得重试
+type Class int
+
+const (
+	// Unclassified 未分类 由调用方决定如何处理
+	Unclassified Class = iota
+	// Retryable 暂时性的错误 稍后重试可能成功
+	Retryable
+	// Permanent 永久性的错误 重试不会成功
+	Permanent
+	// Throttled 被下游限流 应在更长的等待后重试
+	Throttled
+)
+
+func (c Class) String() string {
+	switch c {
+	case Unclassified:
+		return "Unclassified"
+	case Retryable:
+		return "Retryable"
+	case Permanent:
+		return "Permanent"
+	case Throttled:
+		return "Throttled"
+	default:
+		return "Unknown"
+	}
+}
+
+// Classifier 能够报告自身分类的错误
+type Classifier interface {
+	ErrorClass() Class
+}
+
+// ErrorClass 返回e的分类
+func (e MyError) ErrorClass() Class {
+	return e.Class
+}
+
+// WithClass 返回分类为class的e的副本
+func (e MyError) WithClass(class Class) MyError {
+	e.Class = class
+	return e
+}
@@ -0,0 +1,66 @@
+package customError
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// MultiError 收集多个goroutine产生的异常 可以被多个goroutine并发调用
+// MultiError实现了Unwrap() []error 因此errors.Is和errors.As会逐个检查收集到的异常
+type MultiError struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+// Add 收集err err为nil时忽略
+func (m *MultiError) Add(err error) {
+	if err == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errs = append(m.errs, err)
+}
+
+// Len 返回收集到的异常数量
+func (m *MultiError) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.errs)
+}
+
+// Errors 按收集的顺序返回收集到的异常
+func (m *MultiError) Errors() []error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]error(nil), m.errs...)
+}
+
+// ErrorOrNil 未收集到异常时返回nil 否则返回m
+// 函数返回error时应返回ErrorOrNil() 而非m本身 避免返回一个不为nil的空MultiError
+func (m *MultiError) ErrorOrNil() error {
+	if m.Len() == 0 {
+		return nil
+	}
+	return m
+}
+
+func (m *MultiError) Error() string {
+	errs := m.Errors()
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors occurred: %s", len(errs), strings.Join(messages, "; "))
+}
+
+// Unwrap 使errors.Is和errors.As能够检查收集到的每一个异常
+func (m *MultiError) Unwrap() []error {
+	return m.Errors()
+}
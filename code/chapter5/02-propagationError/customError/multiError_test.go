@@ -0,0 +1,69 @@
+package customError
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+	"testing"
+)
+
+type hostErr struct {
+	host string
+}
+
+func (e hostErr) Error() string {
+	return "no such host: " + e.host
+}
+
+func TestMultiError_CollectsFromGoroutines(t *testing.T) {
+	var errs MultiError
+	if errs.ErrorOrNil() != nil {
+		t.Errorf("expected nil, but received %v", errs.ErrorOrNil())
+	}
+
+	hosts := []string{"badHostFoo", "badHostBar", "badHostBaz", "www.baidu.com"}
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			if host != "www.baidu.com" {
+				errs.Add(WrapError(hostErr{host}, "cannot check status of %v", host))
+				return
+			}
+			errs.Add(nil)
+		}(host)
+	}
+	wg.Wait()
+
+	if errs.Len() != 3 {
+		t.Errorf("expected %v, but received %v", 3, errs.Len())
+	}
+
+	var target hostErr
+	if !errors.As(errs.ErrorOrNil(), &target) {
+		t.Errorf("expected errors.As to reach hostErr through MultiError and MyError")
+	}
+}
+
+func TestMyError_UnwrapReachesCause(t *testing.T) {
+	_, statErr := os.Stat("/bad/job/path")
+	err := WrapError(WrapError(statErr, "stat failed"), "cannot run job")
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected errors.Is to reach %v, but received %v", fs.ErrNotExist, err)
+	}
+
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) || pathErr.Path != "/bad/job/path" {
+		t.Errorf("expected errors.As to reach *fs.PathError, but received %v", pathErr)
+	}
+
+	var errs MultiError
+	errs.Add(errors.New("connection reset"))
+	errs.Add(err)
+	if !errors.Is(&errs, fs.ErrNotExist) {
+		t.Errorf("expected errors.Is to reach %v through MultiError", fs.ErrNotExist)
+	}
+}
@@ -10,6 +10,7 @@ type MyError struct {
 	Message    string
 	StackTrace string                 // 用于记录当异常发生时的堆栈跟踪信息
 	Misc       map[string]interface{} // 用于存储其他杂项信息
+	Class      Class                  // 错误的分类 用于决定是否重试
 }
 
 func WrapError(err error, formatMsg string, msgArgs ...interface{}) MyError {
@@ -24,3 +25,8 @@ func WrapError(err error, formatMsg string, msgArgs ...interface{}) MyError {
 func (e MyError) Error() string {
 	return e.Message
 }
+
+// Unwrap 使errors.Is和errors.As能够沿Inner查找被封装的异常
+func (e MyError) Unwrap() error {
+	return e.Inner
+}
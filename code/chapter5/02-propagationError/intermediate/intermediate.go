@@ -10,6 +10,11 @@ type IntermediateErr struct {
 	error
 }
 
+// Unwrap 返回被封装的异常
+func (e IntermediateErr) Unwrap() error {
+	return e.error
+}
+
 func RunJob(id string) error {
 	const jobBinPath = "/bad/job/path"
 	isExecutable, err := lowLevel.IsGloballyExec(jobBinPath)
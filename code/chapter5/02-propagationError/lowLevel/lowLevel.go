@@ -9,6 +9,11 @@ type LowLevelErr struct {
 	error
 }
 
+// Unwrap 返回被封装的异常
+func (e LowLevelErr) Unwrap() error {
+	return e.error
+}
+
 func IsGloballyExec(path string) (bool, error) {
 	info, err := os.Stat(path)
 	if err != nil {
@@ -2,27 +2,39 @@ package main
 
 import (
 	"code/chapter5/02-propagationError/intermediate"
+	"code/chapter5/02-propagationError/reporter"
+	"errors"
 	"fmt"
-	"log"
 	"os"
 )
 
 func main() {
-	log.SetOutput(os.Stdout)
-	log.SetFlags(log.Ltime | log.LUTC)
+	// 写给开发者的Record写入标准输出 实际使用时通常写入文件
+	errorReporter := reporter.New(reporter.Config{
+		Sink:        reporter.NewWriterSink(os.Stdout),
+		UserMessage: userMessage,
+	})
+
 	err := intermediate.RunJob("1")
 	if err != nil {
-		msg := "There was an unexpected issue; please report this as a bug."
-		if _, ok := err.(intermediate.IntermediateErr); ok {
-			msg = err.Error()
-		}
+		handlerError(errorReporter, err)
+	}
+}
 
-		handlerError(1, err, msg)
+// userMessage 只有本模块格式良好的异常才会将消息展示给用户
+func userMessage(err error) (string, bool) {
+	// err可能被其他异常再次封装 因此沿错误链查找 而非直接做类型断言
+	var intermediateErr intermediate.IntermediateErr
+	if errors.As(err, &intermediateErr) {
+		return intermediateErr.Error(), true
 	}
+	return "", false
 }
 
-func handlerError(key int, err error, message string) {
-	log.SetPrefix(fmt.Sprintf("[logID: %v] ", key))
-	log.Printf("%#v", err)
-	fmt.Printf("[%v] %v\n", key, message)
+func handlerError(errorReporter *reporter.Reporter, err error) {
+	incident, reportErr := errorReporter.Report(err)
+	if reportErr != nil {
+		fmt.Fprintf(os.Stderr, "cannot report error: %v\n", reportErr)
+	}
+	fmt.Println(incident)
 }
@@ -0,0 +1,221 @@
+// Package reporter 将异常分别呈现给两类读者
+// 写给开发者的Record包含完整的错误链 堆栈跟踪信息和Misc 以JSON Lines的格式写入Sink
+// 返回给用户的Incident只包含日志ID和一条简短的 不泄露内部细节的消息 用户可以凭日志ID找到对应的Record
+package reporter
+
+import (
+	"code/chapter5/02-propagationError/customError"
+	"code/chapter5/02-propagationError/retry"
+	"code/clock"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// DefaultUserMessage 异常不是格式良好的(UserMessage未认领该异常)时返回给用户的消息
+const DefaultUserMessage = "There was an unexpected issue; please report this as a bug."
+
+// Record 写给开发者的一条异常记录
+type Record struct {
+	LogID      string                 `json:"logID"`
+	Time       time.Time              `json:"time"`
+	Error      string                 `json:"error"`
+	Chain      []Link                 `json:"chain"`
+	StackTrace string                 `json:"stackTrace,omitempty"`
+	Misc       map[string]interface{} `json:"misc,omitempty"`
+	// UserMessage 返回给用户的消息 便于对照用户的反馈
+	UserMessage string `json:"userMessage"`
+}
+
+// Link 错误链中的一个异常 Branches为MultiError等聚合异常中每个异常的错误链
+type Link struct {
+	Type     string   `json:"type"`
+	Message  string   `json:"message"`
+	Branches [][]Link `json:"branches,omitempty"`
+}
+
+// Incident 返回给用户的信息
+type Incident struct {
+	LogID   string
+	Message string
+}
+
+func (i Incident) String() string {
+	return fmt.Sprintf("[%v] %v", i.LogID, i.Message)
+}
+
+type Config struct {
+	// Sink Record的目的地 不能为nil
+	Sink Sink
+	// UserMessage 判断err是否是格式良好的异常 是则返回可以展示给用户的消息和true
+	// 为nil或返回false时 用户只会看到DefaultUserMessage
+	UserMessage func(err error) (string, bool)
+	// Clock 为nil时使用真实时钟
+	Clock clock.Clock
+}
+
+// Reporter 可以被多个goroutine并发使用 每次Report都使用独立的日志ID 不修改log包的全局状态
+type Reporter struct {
+	config Config
+	clk    clock.Clock
+}
+
+func New(config Config) *Reporter {
+	return &Reporter{config: config, clk: clock.OrReal(config.Clock)}
+}
+
+// Report 为err分配一个日志ID 将Record写入Sink 并返回给用户的Incident
+// 写入Sink失败时仍然返回Incident 同时返回写入的错误
+func (r *Reporter) Report(err error) (Incident, error) {
+	incident := Incident{LogID: newLogID(), Message: DefaultUserMessage}
+	if r.config.UserMessage != nil {
+		if message, ok := r.config.UserMessage(err); ok {
+			incident.Message = message
+		}
+	}
+
+	record := Record{
+		LogID:       incident.LogID,
+		Time:        r.clk.Now(),
+		Chain:       chain(err),
+		StackTrace:  stackTrace(err),
+		Misc:        misc(err),
+		UserMessage: incident.Message,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	return incident, r.config.Sink.Write(record)
+}
+
+// newLogID 返回一个随机的16位十六进制日志ID
+func newLogID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand在受支持的平台上不会失败 退而使用时间戳仍能大致保证唯一
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// chain 沿errors.Unwrap展开err 遇到实现了Unwrap() []error的聚合异常时 分别展开其中的每个异常
+func chain(err error) []Link {
+	var links []Link
+	for err != nil {
+		link := Link{Type: reflect.TypeOf(err).String(), Message: err.Error()}
+
+		if multi, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range multi.Unwrap() {
+				link.Branches = append(link.Branches, chain(e))
+			}
+			links = append(links, link)
+			break
+		}
+
+		links = append(links, link)
+		err = errors.Unwrap(err)
+	}
+	return links
+}
+
+// stackTrace 返回错误树中最内层MyError的堆栈跟踪信息 即最接近异常发生处的堆栈
+// 聚合异常的多个分支中都有堆栈时 以深度优先顺序中最后遇到的为准
+func stackTrace(err error) string {
+	var stack string
+	walk(err, func(err error) {
+		if myErr, ok := asMyError(err); ok && myErr.StackTrace != "" {
+			stack = myErr.StackTrace
+		}
+	})
+	return stack
+}
+
+// misc 合并错误树中所有MyError的Misc 同名的键以外层和深度优先顺序中先遇到的为准
+// 无法编码为JSON的值以%+v格式化 error类型的值以及retry.Attempt中的Err记录其Error()
+func misc(err error) map[string]interface{} {
+	merged := make(map[string]interface{})
+	walk(err, func(err error) {
+		myErr, ok := asMyError(err)
+		if !ok {
+			return
+		}
+
+		for key, value := range myErr.Misc {
+			if _, exists := merged[key]; !exists {
+				merged[key] = jsonSafe(value)
+			}
+		}
+	})
+
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// walk 按深度优先的顺序对err及其包装的每个异常调用visit 包括聚合异常的每个分支
+func walk(err error, visit func(err error)) {
+	for err != nil {
+		visit(err)
+
+		if multi, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range multi.Unwrap() {
+				walk(e, visit)
+			}
+			return
+		}
+
+		err = errors.Unwrap(err)
+	}
+}
+
+func asMyError(err error) (customError.MyError, bool) {
+	switch e := err.(type) {
+	case customError.MyError:
+		return e, true
+	case *customError.MyError:
+		return *e, true
+	default:
+		return customError.MyError{}, false
+	}
+}
+
+func jsonSafe(value interface{}) interface{} {
+	if err, ok := value.(error); ok {
+		return err.Error()
+	}
+	if attempts, ok := value.([]retry.Attempt); ok {
+		return attemptsJSON(attempts)
+	}
+	if _, err := json.Marshal(value); err != nil {
+		return fmt.Sprintf("%+v", value)
+	}
+	return value
+}
+
+// attempt 可以编码为JSON的retry.Attempt Err记录其Error() Class记录其名称
+type attempt struct {
+	Number   int
+	Start    time.Time
+	Duration time.Duration
+	Err      string
+	Class    string
+	Delay    time.Duration
+}
+
+// attemptsJSON 转换retry放弃重试时记录在Misc中的尝试记录
+func attemptsJSON(attempts []retry.Attempt) []attempt {
+	converted := make([]attempt, len(attempts))
+	for i, a := range attempts {
+		converted[i] = attempt{Number: a.Number, Start: a.Start, Duration: a.Duration, Class: a.Class.String(), Delay: a.Delay}
+		if a.Err != nil {
+			converted[i].Err = a.Err.Error()
+		}
+	}
+	return converted
+}
@@ -0,0 +1,168 @@
+package reporter
+
+import (
+	"bytes"
+	"code/chapter5/02-propagationError/customError"
+	"code/chapter5/02-propagationError/retry"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type intermediateErr struct {
+	error
+}
+
+func (e intermediateErr) Unwrap() error {
+	return e.error
+}
+
+func jobError() error {
+	_, statErr := os.Stat("/bad/job/path")
+	low := customError.WrapError(statErr, "stat failed")
+	low.Misc["path"] = "/bad/job/path"
+	return intermediateErr{customError.WrapError(low, "cannot run job %q", "1")}
+}
+
+func TestReporter_SplitsUserMessageFromRecord(t *testing.T) {
+	sink := &MemorySink{}
+	r := New(Config{Sink: sink, UserMessage: func(err error) (string, bool) {
+		var target intermediateErr
+		if errors.As(err, &target) {
+			return target.Error(), true
+		}
+		return "", false
+	}})
+
+	incident, err := r.Report(jobError())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if incident.Message != `cannot run job "1"` {
+		t.Errorf("expected %q, but received %q", `cannot run job "1"`, incident.Message)
+	}
+
+	records := sink.Records()
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, but received %v", len(records))
+	}
+
+	record := records[0]
+	if record.LogID != incident.LogID {
+		t.Errorf("expected %v, but received %v", incident.LogID, record.LogID)
+	}
+	expectedTypes := []string{"reporter.intermediateErr", "customError.MyError", "customError.MyError", "*fs.PathError", "syscall.Errno"}
+	if len(record.Chain) != len(expectedTypes) {
+		t.Fatalf("expected chain %v, but received %v", expectedTypes, record.Chain)
+	}
+	for i, e := range expectedTypes {
+		if record.Chain[i].Type != e {
+			t.Errorf("link %v: expected %v, but received %v", i, e, record.Chain[i].Type)
+		}
+	}
+	if !strings.Contains(record.StackTrace, "jobError") {
+		t.Errorf("expected stack trace of the innermost MyError, but received %v", record.StackTrace)
+	}
+	if record.Misc["path"] != "/bad/job/path" {
+		t.Errorf("expected Misc to be collected, but received %v", record.Misc)
+	}
+
+	// 用户看不到任何内部细节
+	if strings.Contains(incident.String(), "stat") {
+		t.Errorf("expected no internal details in %q", incident)
+	}
+}
+
+func TestReporter_DefaultUserMessage(t *testing.T) {
+	r := New(Config{Sink: &MemorySink{}})
+
+	incident, _ := r.Report(jobError())
+	if incident.Message != DefaultUserMessage {
+		t.Errorf("expected %q, but received %q", DefaultUserMessage, incident.Message)
+	}
+}
+
+func TestReporter_ConcurrentReportsWriteJSONLines(t *testing.T) {
+	var buffer bytes.Buffer
+	r := New(Config{Sink: NewWriterSink(&buffer)})
+
+	var errs customError.MultiError
+	errs.Add(errors.New("connection reset"))
+	errs.Add(jobError())
+
+	const n = 50
+	ids := make(chan string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			incident, err := r.Report(&errs)
+			if err != nil {
+				t.Error(err)
+			}
+			ids <- incident.LogID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[string]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("expected unique log IDs, but %v was repeated", id)
+		}
+		seen[id] = true
+	}
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != n {
+		t.Fatalf("expected %v lines, but received %v", n, len(lines))
+	}
+	var record Record
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if len(record.Chain) != 1 || len(record.Chain[0].Branches) != 2 {
+		t.Errorf("expected one MultiError link with 2 branches, but received %v", record.Chain)
+	}
+}
+
+func TestReporter_RetryHistoryIsReadable(t *testing.T) {
+	var buffer bytes.Buffer
+	r := New(Config{Sink: NewWriterSink(&buffer)})
+
+	err := retry.Do(context.Background(), func(ctx context.Context) error {
+		return customError.WrapError(nil, "job binary is not executable").WithClass(customError.Permanent)
+	}, retry.Policy{})
+	r.Report(err)
+
+	if !strings.Contains(buffer.String(), `"Err":"job binary is not executable","Class":"Permanent"`) {
+		t.Errorf("expected readable attempt history, but received %v", buffer.String())
+	}
+}
+
+func TestReporter_WalksMultiErrorBranches(t *testing.T) {
+	sink := &MemorySink{}
+	r := New(Config{Sink: sink})
+
+	var errs customError.MultiError
+	errs.Add(errors.New("unknown"))
+	errs.Add(jobError())
+	if _, err := r.Report(customError.WrapError(errs.ErrorOrNil(), "cannot run batch")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 堆栈和Misc来自聚合异常的分支
+	record := sink.Records()[0]
+	if !strings.Contains(record.StackTrace, "jobError") {
+		t.Errorf("expected stack trace of the branch, but received %q", record.StackTrace)
+	}
+	if record.Misc["path"] != "/bad/job/path" {
+		t.Errorf("expected %v, but received %v", "/bad/job/path", record.Misc["path"])
+	}
+}
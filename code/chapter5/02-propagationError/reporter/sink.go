@@ -0,0 +1,71 @@
+package reporter
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// Sink 保存Record的目的地 Report可能被多个goroutine并发调用 因此Sink必须是并发安全的
+type Sink interface {
+	Write(record Record) error
+}
+
+// WriterSink 将Record以JSON Lines的格式写入io.Writer 每个Record占一行
+type WriterSink struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+	closer  io.Closer
+}
+
+// NewWriterSink 创建写入w的WriterSink 例如os.Stdout
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{encoder: json.NewEncoder(w)}
+}
+
+// OpenFileSink 创建追加写入path的WriterSink 文件不存在时创建 使用完毕后需调用Close
+func OpenFileSink(path string) (*WriterSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	sink := NewWriterSink(file)
+	sink.closer = file
+	return sink, nil
+}
+
+func (s *WriterSink) Write(record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encoder.Encode(record)
+}
+
+// Close 关闭由OpenFileSink打开的文件 对NewWriterSink创建的WriterSink不做任何事
+func (s *WriterSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// MemorySink 将Record保存在内存中 用于测试
+type MemorySink struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+func (s *MemorySink) Write(record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+// Records 按写入的顺序返回保存的Record
+func (s *MemorySink) Records() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Record(nil), s.records...)
+}
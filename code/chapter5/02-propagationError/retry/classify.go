@@ -0,0 +1,101 @@
+package retry
+
+import (
+	"code/chapter5/02-propagationError/customError"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Registry 按错误的具体类型登记分类 用于无法实现customError.Classifier的错误 例如标准库或第三方库的错误
+type Registry struct {
+	mu      sync.RWMutex
+	classes map[reflect.Type]customError.Class
+}
+
+func NewRegistry() *Registry {
+	return &Registry{classes: make(map[reflect.Type]customError.Class)}
+}
+
+// Register 将与example具体类型相同的错误登记为class 重复登记时以最后一次为准
+func (r *Registry) Register(example error, class customError.Class) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.classes[reflect.TypeOf(example)] = class
+}
+
+func (r *Registry) lookup(err error) customError.Class {
+	if r == nil {
+		return customError.Unclassified
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.classes[reflect.TypeOf(err)]
+}
+
+// Classify 沿错误链逐层查找err的分类 返回第一个不是Unclassified的分类
+// 每一层先看错误自身是否实现了customError.Classifier 再查registry
+// 经由errors.Unwrap进入下一层 遇到实现了Unwrap() []error的聚合异常(例如customError.MultiError)时
+// 与errors.As相同 按深度优先的顺序依次查找其中的每个异常 整棵错误树都未分类时返回Unclassified
+func Classify(err error, registry *Registry) customError.Class {
+	class := customError.Unclassified
+	walk(err, func(err error) bool {
+		if classifier, ok := err.(customError.Classifier); ok {
+			class = classifier.ErrorClass()
+		}
+		if class == customError.Unclassified {
+			class = registry.lookup(err)
+		}
+		return class != customError.Unclassified
+	})
+
+	return class
+}
+
+// retryAfter 返回错误树中第一个MyError在Misc中以MiscRetryAfter给出的等待时长
+func retryAfter(err error) (time.Duration, bool) {
+	var d time.Duration
+	found := walk(err, func(err error) bool {
+		var misc map[string]interface{}
+		switch e := err.(type) {
+		case customError.MyError:
+			misc = e.Misc
+		case *customError.MyError:
+			misc = e.Misc
+		default:
+			return false
+		}
+
+		var ok bool
+		d, ok = misc[MiscRetryAfter].(time.Duration)
+		return ok
+	})
+
+	return d, found
+}
+
+// walk 按深度优先的顺序对err及其包装的每个异常调用visit visit返回true时停止 并返回true
+func walk(err error, visit func(err error) bool) bool {
+	for err != nil {
+		if visit(err) {
+			return true
+		}
+
+		if multi, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range multi.Unwrap() {
+				if walk(e, visit) {
+					return true
+				}
+			}
+			return false
+		}
+
+		err = errors.Unwrap(err)
+	}
+
+	return false
+}
@@ -0,0 +1,131 @@
+// Package retry 按错误的分类重试 可重试的错误按退避策略等待后重试 永久性的错误立即返回
+// 被限流的错误按更保守的退避策略等待 放弃重试时 每次尝试的记录保存在返回的customError.MyError的Misc中
+package retry
+
+import (
+	"code/backoff"
+	"code/chapter5/02-propagationError/customError"
+	"code/clock"
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	// MiscAttempts 放弃重试时 返回的MyError.Misc中以该键保存[]Attempt
+	MiscAttempts = "attempts"
+	// MiscRetryAfter 下游可以在MyError.Misc中以该键给出time.Duration类型的建议等待时长 仅对Throttled的错误生效
+	MiscRetryAfter = "retryAfter"
+)
+
+// Attempt 一次尝试的记录
+type Attempt struct {
+	Number   int           // 从1开始的尝试序号
+	Start    time.Time     // 尝试开始的时刻
+	Duration time.Duration // 尝试耗费的时长
+	Err      error
+	Class    customError.Class
+	Delay    time.Duration // 本次尝试之后等待的时长 不再重试时为0
+}
+
+type Policy struct {
+	// MaxAttempts 最多尝试的次数(包括第一次) <=0时为3
+	MaxAttempts int
+	// Backoff Retryable的错误之后的等待策略
+	Backoff backoff.Policy
+	// Throttle Throttled的错误之后的等待策略 Initial为0时使用Backoff
+	Throttle backoff.Policy
+	// Registry 用于分类未实现customError.Classifier的错误 可以为nil
+	Registry *Registry
+	// Unclassified 整条错误链都未分类时采用的分类 为Unclassified时视为Retryable
+	Unclassified customError.Class
+	// Rand 用于生成退避的抖动 为nil时使用math/rand的全局随机数生成器
+	Rand *rand.Rand
+	// Clock 为nil时使用真实时钟
+	Clock clock.Clock
+}
+
+// Do 调用fn直到成功 或遇到Permanent的错误 或尝试次数用尽 或ctx被取消
+// 总的截止时间来自ctx 等待的时长会越过ctx的截止时间时不再等待 直接放弃
+// fn成功时返回nil 否则返回一个MyError 其Inner为最后一次的错误 Class为最后一次错误的分类 Misc[MiscAttempts]为每次尝试的记录
+func Do(ctx context.Context, fn func(ctx context.Context) error, policy Policy) error {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 3
+	}
+	if policy.Unclassified == customError.Unclassified {
+		policy.Unclassified = customError.Retryable
+	}
+	if policy.Throttle.Initial == 0 {
+		policy.Throttle = policy.Backoff
+	}
+
+	clk := clock.OrReal(policy.Clock)
+	retryable := backoff.New(policy.Backoff, policy.Rand)
+	throttled := backoff.New(policy.Throttle, policy.Rand)
+
+	var history []Attempt
+	for {
+		start := clk.Now()
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		attempt := Attempt{
+			Number:   len(history) + 1,
+			Start:    start,
+			Duration: clk.Since(start),
+			Err:      err,
+			Class:    Classify(err, policy.Registry),
+		}
+		if attempt.Class == customError.Unclassified {
+			attempt.Class = policy.Unclassified
+		}
+
+		// ctx已被取消时 fn的错误多半就是ctx的错误 不再重试
+		if ctx.Err() != nil {
+			return giveUp(append(history, attempt), ctx.Err().Error())
+		}
+		if attempt.Class == customError.Permanent || attempt.Number >= policy.MaxAttempts {
+			return giveUp(append(history, attempt), "")
+		}
+
+		if attempt.Class == customError.Throttled {
+			attempt.Delay = throttled.Next()
+			if hint, ok := retryAfter(err); ok && hint > attempt.Delay {
+				attempt.Delay = hint
+			}
+		} else {
+			attempt.Delay = retryable.Next()
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && clk.Now().Add(attempt.Delay).After(deadline) {
+			attempt.Delay = 0
+			return giveUp(append(history, attempt), "deadline")
+		}
+		history = append(history, attempt)
+
+		timer := clk.NewTimer(attempt.Delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return giveUp(history, ctx.Err().Error())
+		case <-timer.C():
+		}
+	}
+}
+
+// giveUp 将最后一次的错误封装为MyError 并在Misc中保存尝试的记录
+func giveUp(history []Attempt, reason string) error {
+	last := history[len(history)-1]
+
+	message := fmt.Sprintf("gave up after %d attempts: %v", len(history), last.Err)
+	if reason != "" {
+		message = fmt.Sprintf("gave up after %d attempts (%s): %v", len(history), reason, last.Err)
+	}
+
+	err := customError.WrapError(last.Err, "%s", message).WithClass(last.Class)
+	err.Misc[MiscAttempts] = history
+	return err
+}
@@ -0,0 +1,191 @@
+package retry
+
+import (
+	"code/backoff"
+	"code/chapter5/02-propagationError/customError"
+	"code/clock"
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+type lowLevelErr struct {
+	error
+}
+
+func TestClassify_WalksChain(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(&os.PathError{}, customError.Permanent)
+
+	statErr := &os.PathError{Op: "stat", Path: "/bad/job/path", Err: os.ErrNotExist}
+	err := customError.WrapError(lowLevelErr{customError.WrapError(statErr, "stat failed")}, "cannot run job")
+
+	// lowLevelErr没有Unwrap 无法进入下一层
+	if class := Classify(err, registry); class != customError.Unclassified {
+		t.Errorf("expected %v, but received %v", customError.Unclassified, class)
+	}
+
+	registry.Register(lowLevelErr{}, customError.Retryable)
+	if class := Classify(err, registry); class != customError.Retryable {
+		t.Errorf("expected %v, but received %v", customError.Retryable, class)
+	}
+
+	// 错误自身的分类优先于registry
+	if class := Classify(err.WithClass(customError.Throttled), registry); class != customError.Throttled {
+		t.Errorf("expected %v, but received %v", customError.Throttled, class)
+	}
+
+	if class := Classify(customError.WrapError(statErr, "stat failed"), registry); class != customError.Permanent {
+		t.Errorf("expected %v, but received %v", customError.Permanent, class)
+	}
+}
+
+func TestClassify_WalksMultiErrorBranches(t *testing.T) {
+	throttled := customError.WrapError(nil, "quota exceeded").WithClass(customError.Throttled)
+	throttled.Misc[MiscRetryAfter] = 3 * time.Second
+
+	// 第一个分支未分类 分类和等待时长来自第二个分支
+	var errs customError.MultiError
+	errs.Add(errors.New("unknown"))
+	errs.Add(customError.WrapError(throttled, "cannot fetch page"))
+	err := customError.WrapError(errs.ErrorOrNil(), "cannot crawl site")
+
+	if class := Classify(err, nil); class != customError.Throttled {
+		t.Errorf("expected %v, but received %v", customError.Throttled, class)
+	}
+	if d, ok := retryAfter(err); !ok || d != 3*time.Second {
+		t.Errorf("expected %v, but received %v", 3*time.Second, d)
+	}
+}
+
+// run 在后台调用Do 每当Do开始等待时推进fake时钟
+func run(clk *clock.Fake, fn func(ctx context.Context) error, policy Policy) error {
+	policy.Clock = clk
+	result := make(chan error, 1)
+	go func() {
+		result <- Do(context.Background(), fn, policy)
+	}()
+
+	for {
+		select {
+		case err := <-result:
+			return err
+		default:
+		}
+
+		if clk.Waiters() > 0 {
+			clk.Advance(time.Minute)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func attempts(t *testing.T, err error) []Attempt {
+	var myErr customError.MyError
+	if !errors.As(err, &myErr) {
+		t.Fatalf("expected customError.MyError, but received %T", err)
+	}
+
+	history, ok := myErr.Misc[MiscAttempts].([]Attempt)
+	if !ok {
+		t.Fatalf("expected attempt history in Misc, but received %v", myErr.Misc)
+	}
+	return history
+}
+
+func TestDo_RetriesUntilSuccess(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	calls := 0
+	err := run(clk, func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return customError.WrapError(nil, "connection reset").WithClass(customError.Retryable)
+		}
+		return nil
+	}, Policy{MaxAttempts: 5, Backoff: backoff.Policy{Initial: time.Second}})
+
+	if err != nil || calls != 3 {
+		t.Errorf("expected success on attempt 3, but received %v after %v calls", err, calls)
+	}
+}
+
+func TestDo_PermanentStopsImmediately(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return customError.WrapError(nil, "job binary is not executable").WithClass(customError.Permanent)
+	}, Policy{MaxAttempts: 5})
+
+	if calls != 1 {
+		t.Errorf("expected 1 call, but received %v", calls)
+	}
+
+	history := attempts(t, err)
+	if len(history) != 1 || history[0].Class != customError.Permanent {
+		t.Errorf("expected one permanent attempt, but received %v", history)
+	}
+}
+
+func TestDo_HistoryInMiscWhenExhausted(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	throttled := customError.WrapError(nil, "too many requests").WithClass(customError.Throttled)
+	throttled.Misc[MiscRetryAfter] = 30 * time.Second
+
+	calls := 0
+	err := run(clk, func(ctx context.Context) error {
+		calls++
+		if calls == 2 {
+			return throttled
+		}
+		return errors.New("connection reset")
+	}, Policy{MaxAttempts: 3, Backoff: backoff.Policy{Initial: time.Second}})
+
+	history := attempts(t, err)
+	if len(history) != 3 {
+		t.Fatalf("expected 3 attempts, but received %v", len(history))
+	}
+
+	expected := []struct {
+		class customError.Class
+		delay time.Duration
+	}{
+		// 未分类的错误视为Retryable
+		{customError.Retryable, time.Second},
+		// Throttled的错误采用下游给出的更长的等待时长
+		{customError.Throttled, 30 * time.Second},
+		{customError.Retryable, 0},
+	}
+	for i, e := range expected {
+		if history[i].Class != e.class || history[i].Delay != e.delay {
+			t.Errorf("attempt %v: expected %v %v, but received %v %v", i+1, e.class, e.delay, history[i].Class, history[i].Delay)
+		}
+	}
+
+	var myErr customError.MyError
+	errors.As(err, &myErr)
+	if myErr.Inner == nil || myErr.Inner.Error() != "connection reset" {
+		t.Errorf("expected last error as Inner, but received %v", myErr.Inner)
+	}
+}
+
+func TestDo_StopsBeforeContextDeadline(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Hour))
+	defer cancel()
+
+	// 第一次等待就会越过截止时间 因此不再等待 直接放弃
+	calls := 0
+	err := Do(ctx, func(ctx context.Context) error {
+		calls++
+		return errors.New("connection reset")
+	}, Policy{MaxAttempts: 10, Backoff: backoff.Policy{Initial: 2 * time.Hour}, Clock: clk})
+
+	if calls != 1 {
+		t.Errorf("expected 1 call, but received %v", calls)
+	}
+	if history := attempts(t, err); history[0].Delay != 0 {
+		t.Errorf("expected no delay past the deadline, but received %v", history[0].Delay)
+	}
+}
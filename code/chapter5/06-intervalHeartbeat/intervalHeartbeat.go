@@ -1,12 +1,15 @@
 package main
 
-import "time"
+import (
+	"code/clock"
+	"time"
+)
 
 func main() {
 
 }
 
-func doWork(done <-chan interface{}, pulseInterval time.Duration) (<-chan interface{}, <-chan time.Time) {
+func doWork(done <-chan interface{}, clk clock.Clock, pulseInterval time.Duration) (<-chan interface{}, <-chan time.Time) {
 	heartbeat := make(chan interface{})
 	results := make(chan time.Time)
 
@@ -14,8 +17,8 @@ func doWork(done <-chan interface{}, pulseInterval time.Duration) (<-chan interf
 		defer close(heartbeat)
 		defer close(results)
 
-		pulse := time.Tick(pulseInterval)
-		workGen := time.Tick(2 * pulseInterval)
+		pulse := clk.Tick(pulseInterval)
+		workGen := clk.Tick(2 * pulseInterval)
 
 		sendPulse := func() {
 			select {
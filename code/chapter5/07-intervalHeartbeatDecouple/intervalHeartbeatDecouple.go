@@ -1,12 +1,19 @@
 package main
 
-import "time"
+import (
+	"code/clock"
+	"code/heartbeat"
+	"strconv"
+	"time"
+)
 
 func main() {
 
 }
 
-func doWork(done <-chan interface{}, pulseInterval time.Duration) (<-chan interface{}, <-chan time.Time) {
+// doWork 心跳携带heartbeat.Progress 使得监视者不仅知道goroutine还活着 还知道它是否有进展
+// 调用方不读取results时 goroutine会停留在sendResult中 此时仍然发出心跳 但Processed不再增加
+func doWork(done <-chan interface{}, clk clock.Clock, pulseInterval time.Duration) (<-chan interface{}, <-chan time.Time) {
 	heartbeat := make(chan interface{})
 	results := make(chan time.Time)
 
@@ -14,17 +21,21 @@ func doWork(done <-chan interface{}, pulseInterval time.Duration) (<-chan interf
 		defer close(heartbeat)
 		defer close(results)
 
-		pulse := time.Tick(pulseInterval)
-		workGen := time.Tick(2 * pulseInterval)
+		pulse := clk.Tick(pulseInterval)
+		workGen := clk.Tick(2 * pulseInterval)
+		processed := 0
 
 		for {
 			select {
 			case <-done:
 				return
 			case <-pulse:
-				sendPulse(heartbeat)
+				sendPulse(heartbeat, progress(processed, false))
 			case r := <-workGen:
-				sendResult(done, results, r, pulse, heartbeat)
+				if !sendResult(done, results, r, pulse, heartbeat, processed) {
+					return
+				}
+				processed++
 			}
 		}
 	}()
@@ -32,22 +43,37 @@ func doWork(done <-chan interface{}, pulseInterval time.Duration) (<-chan interf
 	return heartbeat, results
 }
 
-func sendPulse(heartbeat chan interface{}) {
+// progress 构造心跳携带的进度 pending表示是否有一个结果正在等待调用方读取
+func progress(processed int, pending bool) heartbeat.Progress {
+	if !pending {
+		return heartbeat.Progress{Processed: processed}
+	}
+
+	// 条目按生成的顺序编号 正在发送的是第processed+1个
+	return heartbeat.Progress{
+		Processed:  processed,
+		CurrentID:  strconv.Itoa(processed + 1),
+		QueueDepth: 1,
+	}
+}
+
+func sendPulse(heartbeat chan interface{}, p heartbeat.Progress) {
 	select {
-	case heartbeat <- struct{}{}:
+	case heartbeat <- p:
 	default:
 	}
 }
 
-func sendResult(done <-chan interface{}, results chan time.Time, r time.Time, pulse <-chan time.Time, heartbeat chan interface{}) {
+// sendResult 返回结果是否被发送 done被关闭时返回false
+func sendResult(done <-chan interface{}, results chan time.Time, r time.Time, pulse <-chan time.Time, heartbeat chan interface{}, processed int) bool {
 	for {
 		select {
 		case <-done:
-			return
+			return false
 		case <-pulse:
-			sendPulse(heartbeat)
+			sendPulse(heartbeat, progress(processed, true))
 		case results <- r:
-			return
+			return true
 		}
 	}
 }
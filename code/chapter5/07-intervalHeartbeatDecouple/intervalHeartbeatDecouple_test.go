@@ -0,0 +1,61 @@
+package main
+
+import (
+	"code/clock"
+	"code/heartbeat"
+	"testing"
+	"time"
+)
+
+// advanceUntil 每次推进一个心跳间隔 直到condition返回true
+// 心跳是非阻塞发送的 Monitor恰好忙碌时心跳会被丢弃 因此不能假设推进一次就一定收到一次心跳
+func advanceUntil(t *testing.T, clk *clock.Fake, pulseInterval time.Duration, condition func() bool) {
+	t.Helper()
+
+	for i := 0; i < 100; i++ {
+		if condition() {
+			return
+		}
+		clk.Advance(pulseInterval)
+		time.Sleep(1 * time.Millisecond)
+	}
+	t.Fatal("condition not met")
+}
+
+func TestDoWork_StallsWhenResultsAreNotRead(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	const pulseInterval = 1 * time.Second
+	clk := clock.NewFake(time.Now())
+	pulses, results := doWork(done, clk, pulseInterval)
+	// doWork的两个Ticker创建完毕后再启动Monitor 以免BlockUntil把Monitor的定时器也计算在内
+	clk.BlockUntil(2)
+
+	m := heartbeat.NewMonitor(done, pulses, results, heartbeat.Config{
+		// 间隔足够大 使Monitor不会因为被丢弃的心跳而判定漏跳
+		Interval:   100 * pulseInterval,
+		StallAfter: 2,
+		Clock:      clk,
+	})
+
+	// 不读取结果 Monitor取走第1个结果后等待调用方读取 doWork停留在第2个结果的sendResult中 仍然发出心跳 但没有进展
+	advanceUntil(t, clk, pulseInterval, func() bool { return m.State() == heartbeat.Stalled })
+
+	progress := m.Stats().Progress
+	if progress.Processed != 1 || progress.CurrentID != "2" || progress.QueueDepth != 1 {
+		t.Errorf("expected item 2 to be stuck after 1 processed, but received %+v", progress)
+	}
+
+	<-m.Results()
+	advanceUntil(t, clk, pulseInterval, func() bool { return m.Stats().Progress.Processed == 2 })
+
+	// 结果被读取后doWork有了进展 Monitor离开Stalled状态
+	var states []heartbeat.State
+	for len(m.Changes()) > 0 {
+		states = append(states, (<-m.Changes()).To)
+	}
+	if len(states) < 2 || states[0] != heartbeat.Stalled || states[1] != heartbeat.Healthy {
+		t.Errorf("expected changes to start with Stalled then Healthy, but received %v", states)
+	}
+}
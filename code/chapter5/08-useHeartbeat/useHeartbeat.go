@@ -1,16 +1,18 @@
 package main
 
 import (
+	"code/clock"
 	"fmt"
 	"time"
 )
 
 func main() {
+	clk := clock.Real{}
 	done := make(chan interface{})
 	time.AfterFunc(10*time.Second, func() { close(done) })
 
 	const timeout = 2 * time.Second
-	heartbeat, results := doWork(done, timeout/2)
+	heartbeat, results := doWork(done, clk, timeout/2)
 
 	for {
 		select {
@@ -24,13 +26,13 @@ func main() {
 				return
 			}
 			fmt.Printf("results %v\n", r.Second())
-		case <-time.After(timeout):
+		case <-clk.After(timeout):
 			return
 		}
 	}
 }
 
-func doWork(done <-chan interface{}, pulseInterval time.Duration) (<-chan interface{}, <-chan time.Time) {
+func doWork(done <-chan interface{}, clk clock.Clock, pulseInterval time.Duration) (<-chan interface{}, <-chan time.Time) {
 	heartbeat := make(chan interface{})
 	results := make(chan time.Time)
 
@@ -38,8 +40,8 @@ func doWork(done <-chan interface{}, pulseInterval time.Duration) (<-chan interf
 		defer close(heartbeat)
 		defer close(results)
 
-		pulse := time.Tick(pulseInterval)
-		workGen := time.Tick(2 * pulseInterval)
+		pulse := clk.Tick(pulseInterval)
+		workGen := clk.Tick(2 * pulseInterval)
 
 		for {
 			select {
@@ -1,12 +1,15 @@
 package main
 
-import "time"
+import (
+	"code/clock"
+	"time"
+)
 
 func main() {
 
 }
 
-func DoWork(done <-chan interface{}, nums ...int) (<-chan interface{}, <-chan int) {
+func DoWork(done <-chan interface{}, clk clock.Clock, nums ...int) (<-chan interface{}, <-chan int) {
 	heartbeat := make(chan interface{})
 	intStream := make(chan int)
 
@@ -14,7 +17,7 @@ func DoWork(done <-chan interface{}, nums ...int) (<-chan interface{}, <-chan in
 		defer close(heartbeat)
 		defer close(intStream)
 
-		time.Sleep(2 * time.Second)
+		clk.Sleep(2 * time.Second)
 
 		for _, num := range nums {
 			select {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"code/clock"
 	"testing"
 	"time"
 )
@@ -9,7 +10,7 @@ func main() {
 
 }
 
-func DoWork(done <-chan interface{}, nums ...int) (<-chan interface{}, <-chan int) {
+func DoWork(done <-chan interface{}, clk clock.Clock, nums ...int) (<-chan interface{}, <-chan int) {
 	heartbeat := make(chan interface{})
 	intStream := make(chan int)
 
@@ -17,7 +18,7 @@ func DoWork(done <-chan interface{}, nums ...int) (<-chan interface{}, <-chan in
 		defer close(heartbeat)
 		defer close(intStream)
 
-		time.Sleep(2 * time.Second)
+		clk.Sleep(2 * time.Second)
 
 		for _, num := range nums {
 			select {
@@ -40,8 +41,16 @@ func TestDoWork_GeneratesAllNumbers(t *testing.T) {
 	done := make(chan interface{})
 	defer close(done)
 
+	clk := clock.NewFake(time.Now())
 	intSlice := []int{0, 1, 2, 3, 5}
-	_, results := DoWork(done, intSlice...)
+	_, results := DoWork(done, clk, intSlice...)
+
+	// 等待DoWork中的Sleep和下方的超时定时器都创建后 将时间推进1s
+	// 此时DoWork仍在Sleep 超时先于结果到达 这正是本测试的缺陷所在
+	go func() {
+		clk.BlockUntil(2)
+		clk.Advance(1 * time.Second)
+	}()
 
 	for i, expected := range intSlice {
 		select {
@@ -49,7 +58,7 @@ func TestDoWork_GeneratesAllNumbers(t *testing.T) {
 			if result != expected {
 				t.Errorf("index %v expected %v, but received %v\n", i, expected, result)
 			}
-		case <-time.After(1 * time.Second):
+		case <-clk.After(1 * time.Second):
 			t.Fatal("test timed out")
 		}
 	}
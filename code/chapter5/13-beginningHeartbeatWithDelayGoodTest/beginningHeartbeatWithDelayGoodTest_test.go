@@ -1,6 +1,7 @@
 package main
 
 import (
+	"code/clock"
 	"testing"
 	"time"
 )
@@ -9,7 +10,7 @@ func main() {
 
 }
 
-func DoWork(done <-chan interface{}, nums ...int) (<-chan interface{}, <-chan int) {
+func DoWork(done <-chan interface{}, clk clock.Clock, nums ...int) (<-chan interface{}, <-chan int) {
 	heartbeat := make(chan interface{})
 	intStream := make(chan int)
 
@@ -17,7 +18,7 @@ func DoWork(done <-chan interface{}, nums ...int) (<-chan interface{}, <-chan in
 		defer close(heartbeat)
 		defer close(intStream)
 
-		time.Sleep(2 * time.Second)
+		clk.Sleep(2 * time.Second)
 
 		for _, num := range nums {
 			select {
@@ -40,8 +41,13 @@ func TestDoWork_GeneratesAllNumbers(t *testing.T) {
 	done := make(chan interface{})
 	defer close(done)
 
+	clk := clock.NewFake(time.Now())
 	intSlice := []int{0, 1, 2, 3, 5}
-	heartbeat, results := DoWork(done, intSlice...)
+	heartbeat, results := DoWork(done, clk, intSlice...)
+
+	// 推进时间使DoWork结束Sleep 无需真的等待2s
+	clk.BlockUntil(1)
+	clk.Advance(2 * time.Second)
 
 	<-heartbeat
 
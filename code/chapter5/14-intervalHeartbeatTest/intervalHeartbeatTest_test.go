@@ -1,6 +1,7 @@
 package main
 
 import (
+	"code/clock"
 	"testing"
 	"time"
 )
@@ -9,7 +10,7 @@ func main() {
 
 }
 
-func DoWork(done <-chan interface{}, pulseInterval time.Duration, nums ...int) (<-chan interface{}, <-chan int) {
+func DoWork(done <-chan interface{}, clk clock.Clock, pulseInterval time.Duration, nums ...int) (<-chan interface{}, <-chan int) {
 	heartbeat := make(chan interface{}, 1)
 	intStream := make(chan int)
 
@@ -17,9 +18,9 @@ func DoWork(done <-chan interface{}, pulseInterval time.Duration, nums ...int) (
 		defer close(heartbeat)
 		defer close(intStream)
 
-		time.Sleep(2 * time.Second)
+		clk.Sleep(2 * time.Second)
 
-		pulse := time.Tick(pulseInterval)
+		pulse := clk.Tick(pulseInterval)
 	numLoop:
 		for _, num := range nums {
 			for {
@@ -47,7 +48,14 @@ func TestDoWork_GeneratesAllNumbers(t *testing.T) {
 
 	intSlice := []int{0, 1, 2, 3, 5}
 	const timeout = 2 * time.Second
-	heartbeat, results := DoWork(done, timeout/2, intSlice...)
+	clk := clock.NewFake(time.Now())
+	heartbeat, results := DoWork(done, clk, timeout/2, intSlice...)
+
+	// 先推进2s使DoWork结束Sleep 待其创建pulse后再推进一个心跳间隔 使其发出第一次心跳
+	clk.BlockUntil(1)
+	clk.Advance(2 * time.Second)
+	clk.BlockUntil(1)
+	clk.Advance(timeout / 2)
 
 	<-heartbeat
 
@@ -62,7 +70,7 @@ func TestDoWork_GeneratesAllNumbers(t *testing.T) {
 			}
 			i++
 		case <-heartbeat:
-		case <-time.After(timeout):
+		case <-clk.After(timeout):
 			t.Fatal("test timed out")
 		}
 	}
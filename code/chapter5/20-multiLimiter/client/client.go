@@ -32,10 +32,10 @@ func (a *APIConnection) ResolveAddress(ctx context.Context) error {
 
 func Open() *APIConnection {
 	// 秒级限速器 限制每秒最多2个事件 桶深度为1
-	secondLimit := rate.NewLimiter(Per(2, time.Second), 1)
+	secondLimit := multiLimiter.NewLimiter(Per(2, time.Second), 1)
 
 	// 分级限速器 限制每分钟最多10个事件 桶深度为10
-	minuteLimit := rate.NewLimiter(Per(10, time.Minute), 10)
+	minuteLimit := multiLimiter.NewLimiter(Per(10, time.Minute), 10)
 
 	return &APIConnection{
 		rateLimiter: multiLimiter.NewMultiLimiter(secondLimit, minuteLimit),
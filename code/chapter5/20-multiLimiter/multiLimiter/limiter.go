@@ -0,0 +1,26 @@
+package multiLimiter
+
+import (
+	"code/chapter5/20-multiLimiter/multiLimiterI"
+	"golang.org/x/time/rate"
+	"time"
+)
+
+// Limiter 使*rate.Limiter满足multiLimiterI.RateLimiter接口
+// *rate.Limiter的Reserve和ReserveN方法返回的是*rate.Reservation 因此需要包装一层
+type Limiter struct {
+	*rate.Limiter
+}
+
+// NewLimiter 与rate.NewLimiter相同 但返回的限速器可以交给NewMultiLimiter组合
+func NewLimiter(r rate.Limit, b int) *Limiter {
+	return &Limiter{Limiter: rate.NewLimiter(r, b)}
+}
+
+func (l *Limiter) Reserve() multiLimiterI.Reservation {
+	return l.Limiter.Reserve()
+}
+
+func (l *Limiter) ReserveN(t time.Time, n int) multiLimiterI.Reservation {
+	return l.Limiter.ReserveN(t, n)
+}
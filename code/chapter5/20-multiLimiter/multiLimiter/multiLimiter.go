@@ -3,28 +3,88 @@ package multiLimiter
 import (
 	"code/chapter5/20-multiLimiter/multiLimiterI"
 	"context"
+	"fmt"
 	"golang.org/x/time/rate"
 	"sort"
+	"time"
 )
 
 type MultiLimiter struct {
 	limiters []multiLimiterI.RateLimiter
 }
 
+// Wait 等待直到所有限速器都允许执行 或ctx被取消
+// 令牌是从所有限速器中一次性预留的 ctx被取消时所有预留都会被归还 不会出现只消耗了部分限速器令牌的情况
 func (m *MultiLimiter) Wait(ctx context.Context) error {
-	for _, limiter := range m.limiters {
-		if err := limiter.Wait(ctx); err != nil {
-			return err
-		}
+	now := time.Now()
+	reservation := m.ReserveN(now, 1)
+	if !reservation.OK() {
+		return fmt.Errorf("multiLimiter: cannot reserve a token from every limiter")
+	}
+
+	delay := reservation.DelayFrom(now)
+	if delay == 0 {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && deadline.Sub(now) < delay {
+		reservation.CancelAt(now)
+		return fmt.Errorf("multiLimiter: wait %v would exceed context deadline", delay)
 	}
 
-	return nil
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		reservation.Cancel()
+		return ctx.Err()
+	}
 }
 
 func (m *MultiLimiter) Limit() rate.Limit {
 	return m.limiters[0].Limit()
 }
 
+// Allow 只有当所有限速器此刻都有可用的令牌时 才从每个限速器中各取走1个令牌并返回true
+// 否则归还已经预留的令牌并返回false
+func (m *MultiLimiter) Allow() bool {
+	now := time.Now()
+	reservation := m.ReserveN(now, 1)
+	if !reservation.OK() || reservation.DelayFrom(now) > 0 {
+		reservation.CancelAt(now)
+		return false
+	}
+
+	return true
+}
+
+// Reserve 从所有限速器中各预留1个令牌 任意一个限速器预留失败时 取消已经完成的预留
+func (m *MultiLimiter) Reserve() multiLimiterI.Reservation {
+	return m.ReserveN(time.Now(), 1)
+}
+
+// ReserveN 在t时刻从所有限速器中各预留n个令牌
+func (m *MultiLimiter) ReserveN(t time.Time, n int) multiLimiterI.Reservation {
+	reservations := make([]multiLimiterI.Reservation, 0, len(m.limiters))
+	for _, limiter := range m.limiters {
+		reservation := limiter.ReserveN(t, n)
+		if !reservation.OK() {
+			// 所有预留都是在t时刻完成的 以t为当前时刻取消预留才能归还全部令牌
+			for _, reserved := range reservations {
+				reserved.CancelAt(t)
+			}
+			return failedReservation{}
+		}
+
+		reservations = append(reservations, reservation)
+	}
+
+	return &multiReservation{reservations: reservations}
+}
+
 func NewMultiLimiter(limiters ...multiLimiterI.RateLimiter) *MultiLimiter {
 	byLimit := func(i, j int) bool {
 		// 按限流器限制的速度从低到高排序
@@ -34,3 +94,59 @@ func NewMultiLimiter(limiters ...multiLimiterI.RateLimiter) *MultiLimiter {
 	sort.Slice(limiters, byLimit)
 	return &MultiLimiter{limiters: limiters}
 }
+
+// multiReservation 由多个限速器的预留组合而成的预留 需要等待的时长为其中最长的等待时长
+type multiReservation struct {
+	reservations []multiLimiterI.Reservation
+}
+
+func (r *multiReservation) OK() bool {
+	return true
+}
+
+func (r *multiReservation) Delay() time.Duration {
+	return r.DelayFrom(time.Now())
+}
+
+func (r *multiReservation) DelayFrom(t time.Time) time.Duration {
+	var delay time.Duration
+	for _, reservation := range r.reservations {
+		if d := reservation.DelayFrom(t); d > delay {
+			delay = d
+		}
+	}
+
+	return delay
+}
+
+// Cancel 以当前时刻归还所有限速器的令牌
+// 不能以预留时的时刻取消: rate.Limiter在归还令牌时会把自己的时钟设为取消的时刻 时钟回退后同一段时间会被重复计入令牌
+// 代价是已经到了执行时刻的限速器(通常是较快的限速器)的令牌不再归还 限速器只会更保守 不会放行过多的请求
+func (r *multiReservation) Cancel() {
+	r.CancelAt(time.Now())
+}
+
+func (r *multiReservation) CancelAt(t time.Time) {
+	for _, reservation := range r.reservations {
+		reservation.CancelAt(t)
+	}
+}
+
+// failedReservation 预留失败时返回的预留
+type failedReservation struct{}
+
+func (failedReservation) OK() bool {
+	return false
+}
+
+func (failedReservation) Delay() time.Duration {
+	return rate.InfDuration
+}
+
+func (failedReservation) DelayFrom(time.Time) time.Duration {
+	return rate.InfDuration
+}
+
+func (failedReservation) Cancel() {}
+
+func (failedReservation) CancelAt(time.Time) {}
@@ -0,0 +1,97 @@
+package multiLimiter
+
+import (
+	"context"
+	"golang.org/x/time/rate"
+	"testing"
+	"time"
+)
+
+func TestMultiLimiter_AllowIsAllOrNothing(t *testing.T) {
+	fast := NewLimiter(rate.Limit(100), 5)
+	slow := NewLimiter(rate.Every(time.Hour), 1)
+	m := NewMultiLimiter(fast, slow)
+
+	if !m.Allow() {
+		t.Fatal("expected first call to be allowed")
+	}
+
+	// slow的令牌已经用完 后续调用不能消耗fast的令牌
+	for i := 0; i < 10; i++ {
+		if m.Allow() {
+			t.Fatalf("call %v: expected to be rejected", i)
+		}
+	}
+
+	if tokens := fast.Tokens(); tokens < 3.9 {
+		t.Errorf("expected rejected calls to leave fast limiter tokens untouched, but %v left", tokens)
+	}
+}
+
+func TestMultiLimiter_ReserveCancelsPartialReservations(t *testing.T) {
+	fast := NewLimiter(rate.Every(time.Hour), 2)
+	// 桶深为0的限速器无法预留任何令牌
+	empty := NewLimiter(rate.Every(time.Hour), 0)
+	m := NewMultiLimiter(fast, empty)
+
+	reservation := m.Reserve()
+	if reservation.OK() {
+		t.Fatal("expected reservation to fail")
+	}
+	if tokens := fast.Tokens(); tokens < 1.9 {
+		t.Errorf("expected partial reservation to be cancelled, but %v tokens left", tokens)
+	}
+}
+
+func TestMultiLimiter_ReserveDelayIsLongestChildDelay(t *testing.T) {
+	m := NewMultiLimiter(
+		NewLimiter(rate.Every(time.Second), 1),
+		NewLimiter(rate.Every(time.Minute), 1),
+	)
+
+	m.Reserve()
+	reservation := m.Reserve()
+	if !reservation.OK() {
+		t.Fatal("expected reservation to succeed")
+	}
+	if delay := reservation.Delay(); delay < 59*time.Second {
+		t.Errorf("expected delay close to 1m, but received %v", delay)
+	}
+	reservation.Cancel()
+}
+
+func TestMultiLimiter_WaitReturnsTokensOnDeadline(t *testing.T) {
+	fast := NewLimiter(rate.Every(time.Hour), 2)
+	slow := NewLimiter(rate.Every(time.Hour), 1)
+	m := NewMultiLimiter(fast, slow)
+
+	if err := m.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.Wait(ctx); err == nil {
+		t.Fatal("expected wait to fail")
+	}
+
+	if tokens := fast.Tokens(); tokens < 0.9 {
+		t.Errorf("expected failed wait to return fast limiter token, but %v left", tokens)
+	}
+}
+
+func TestMultiLimiter_CancelDoesNotRewindLimiterClock(t *testing.T) {
+	limiter := NewLimiter(rate.Every(time.Hour), 5)
+	m := NewMultiLimiter(limiter)
+
+	// 2小时前预留3个令牌 1小时前再预留1个 之后取消第1个预留 第2个预留仍被持有
+	start := time.Now().Add(-2 * time.Hour)
+	first := m.ReserveN(start, 3)
+	m.ReserveN(start.Add(time.Hour), 1)
+	first.Cancel()
+
+	// 第1个预留早已执行 取消时不归还令牌: 5-3-1 再加上2小时内补充的2个
+	if tokens := limiter.Tokens(); tokens > 3.01 {
+		t.Errorf("expected at most 3 tokens after cancelling, but received %v", tokens)
+	}
+}
@@ -3,9 +3,27 @@ package multiLimiterI
 import (
 	"context"
 	"golang.org/x/time/rate"
+	"time"
 )
 
 type RateLimiter interface {
 	Wait(ctx context.Context) error
 	Limit() rate.Limit
+	// Allow 若此刻有可用的令牌则取走1个并返回true 否则立即返回false 不会等待
+	Allow() bool
+	// Reserve 预留1个令牌 调用者需要等待Reservation.Delay()后才能执行操作 放弃执行时需调用Reservation.Cancel()归还令牌
+	Reserve() Reservation
+	// ReserveN 在t时刻预留n个令牌
+	ReserveN(t time.Time, n int) Reservation
+}
+
+// Reservation 对*rate.Reservation的抽象 使得多个限速器的预留可以组合为一个预留
+type Reservation interface {
+	// OK 是否预留成功 请求的令牌数超过桶深时预留失败
+	OK() bool
+	Delay() time.Duration
+	DelayFrom(t time.Time) time.Duration
+	Cancel()
+	// CancelAt 以t为当前时刻归还令牌 t晚于可以执行的时刻时 令牌被视为已经使用 不会归还
+	CancelAt(t time.Time)
 }
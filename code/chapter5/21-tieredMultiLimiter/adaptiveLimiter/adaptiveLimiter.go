@@ -0,0 +1,106 @@
+// Package adaptiveLimiter 根据下游的反馈自动调整速率的限速器
+// 请求成功时加性增加速率 失败或延迟超标时乘性降低速率(AIMD)
+package adaptiveLimiter
+
+import (
+	"code/chapter5/21-tieredMultiLimiter/multiLimiter"
+	"code/chapter5/21-tieredMultiLimiter/multiLimiterI"
+	"code/clock"
+	"golang.org/x/time/rate"
+	"math"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// Initial 初始速率
+	Initial rate.Limit
+	// Min 速率的下限 <=0时为每秒1个事件 下限必须大于0 否则速率降为0后不再有请求 也就不再有反馈
+	Min rate.Limit
+	// Max 速率的上限 <=0时不设上限
+	Max rate.Limit
+	// Burst 桶深 <=0时为1
+	Burst int
+	// Increase 每秒增加的速率 每次成功增加Increase/当前速率 因此无论当前速率多大 每秒大约增加Increase <=0时为1
+	Increase rate.Limit
+	// Decrease 失败时速率乘以的系数 不在(0, 1)之间时为0.5
+	Decrease float64
+	// LatencyThreshold 延迟超过该值视为下游过载 <=0表示不按延迟调整
+	LatencyThreshold time.Duration
+	// Cooldown 两次降低速率的最短间隔 同一批在途请求的失败只降低一次速率
+	Cooldown time.Duration
+	// Clock 为nil时使用真实时钟
+	Clock clock.Clock
+}
+
+// Limiter 满足multiLimiterI.RateLimiter接口 Limit()返回当前的速率
+// 调用方需要在每次请求完成后调用Observe报告结果
+type Limiter struct {
+	*multiLimiter.Limiter
+	config Config
+	clk    clock.Clock
+
+	mu           sync.Mutex
+	lastDecrease time.Time
+	decreased    bool
+}
+
+var _ multiLimiterI.RateLimiter = (*Limiter)(nil)
+
+func New(config Config) *Limiter {
+	if config.Min <= 0 {
+		config.Min = 1
+	}
+	if config.Max <= 0 {
+		config.Max = rate.Limit(math.MaxFloat64)
+	}
+	if config.Burst <= 0 {
+		config.Burst = 1
+	}
+	if config.Increase <= 0 {
+		config.Increase = 1
+	}
+	if config.Decrease <= 0 || config.Decrease >= 1 {
+		config.Decrease = 0.5
+	}
+
+	return &Limiter{
+		Limiter: multiLimiter.NewLimiter(clamp(config.Initial, config.Min, config.Max), config.Burst),
+		config:  config,
+		clk:     clock.OrReal(config.Clock),
+	}
+}
+
+// Observe 报告一次请求的结果 err不为nil或latency超过LatencyThreshold时降低速率 否则提高速率
+func (l *Limiter) Observe(latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clk.Now()
+	limit := l.Limit()
+
+	overloaded := err != nil || (l.config.LatencyThreshold > 0 && latency > l.config.LatencyThreshold)
+	if !overloaded {
+		l.SetLimitAt(now, clamp(limit+l.config.Increase/limit, l.config.Min, l.config.Max))
+		return
+	}
+
+	if l.decreased && now.Sub(l.lastDecrease) < l.config.Cooldown {
+		return
+	}
+
+	l.SetLimitAt(now, clamp(limit*rate.Limit(l.config.Decrease), l.config.Min, l.config.Max))
+	l.lastDecrease = now
+	l.decreased = true
+}
+
+func clamp(limit, min, max rate.Limit) rate.Limit {
+	if limit < min {
+		return min
+	}
+	if limit > max {
+		return max
+	}
+
+	return limit
+}
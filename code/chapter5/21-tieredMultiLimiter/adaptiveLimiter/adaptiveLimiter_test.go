@@ -0,0 +1,124 @@
+package adaptiveLimiter
+
+import (
+	"code/clock"
+	"errors"
+	"golang.org/x/time/rate"
+	"testing"
+	"time"
+)
+
+var errOverloaded = errors.New("backend overloaded")
+
+// backend 模拟的下游服务 每秒最多处理capacity个请求 超出的请求失败
+type backend struct {
+	capacity int
+	second   int64
+	served   int
+}
+
+func (b *backend) handle(now time.Time) error {
+	if second := now.Unix(); second != b.second {
+		b.second = second
+		b.served = 0
+	}
+
+	if b.served >= b.capacity {
+		return errOverloaded
+	}
+
+	b.served++
+	return nil
+}
+
+// runPhase 以恒定容量运行若干秒 返回最后3秒内成功的请求数和失败的请求数
+func runPhase(clk *clock.Fake, limiter *Limiter, b *backend, capacity int, seconds int) (succeeded, failed int) {
+	b.capacity = capacity
+	for step := 0; step < seconds*1000; step++ {
+		clk.Advance(time.Millisecond)
+		now := clk.Now()
+
+		// 客户端每毫秒最多发出1个请求 需求远大于后端容量
+		if !limiter.AllowN(now, 1) {
+			continue
+		}
+
+		err := b.handle(now)
+		limiter.Observe(0, err)
+
+		if step >= (seconds-3)*1000 {
+			if err != nil {
+				failed++
+			} else {
+				succeeded++
+			}
+		}
+	}
+
+	return succeeded, failed
+}
+
+func TestLimiter_TracksChangingBackendCapacity(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	limiter := New(Config{
+		Initial:  10,
+		Max:      500,
+		Burst:    1,
+		Increase: 10,
+		Decrease: 0.7,
+		Cooldown: 500 * time.Millisecond,
+		Clock:    clk,
+	})
+	b := &backend{}
+
+	for _, capacity := range []int{100, 30, 200} {
+		succeeded, failed := runPhase(clk, limiter, b, capacity, 20)
+
+		// 最后3秒内 吞吐接近容量 且失败率较低
+		if succeeded < capacity*3*6/10 {
+			t.Errorf("capacity %v: expected at least 60%% of capacity to be used, but %v requests succeeded in 3s", capacity, succeeded)
+		}
+		if failed*5 > succeeded {
+			t.Errorf("capacity %v: expected at most 20%% failures, but %v failed and %v succeeded", capacity, failed, succeeded)
+		}
+		if limit := limiter.Limit(); limit > rate.Limit(capacity)*1.5 {
+			t.Errorf("capacity %v: expected limit to stay near capacity, but received %v", capacity, limit)
+		}
+	}
+}
+
+func TestLimiter_LatencyBreachDecreasesLimit(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	limiter := New(Config{Initial: 100, LatencyThreshold: 50 * time.Millisecond, Clock: clk})
+
+	limiter.Observe(10*time.Millisecond, nil)
+	if limit := limiter.Limit(); limit <= 100 {
+		t.Errorf("expected fast response to raise limit, but received %v", limit)
+	}
+
+	limiter.Observe(80*time.Millisecond, nil)
+	if limit := limiter.Limit(); limit > 51 {
+		t.Errorf("expected slow response to halve limit, but received %v", limit)
+	}
+}
+
+func TestLimiter_CooldownCoalescesDecreases(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	limiter := New(Config{Initial: 100, Min: 10, Cooldown: time.Second, Clock: clk})
+
+	for i := 0; i < 5; i++ {
+		limiter.Observe(0, errOverloaded)
+	}
+	if limit := limiter.Limit(); limit != 50 {
+		t.Errorf("expected a single decrease within cooldown, but received %v", limit)
+	}
+
+	clk.Advance(time.Second)
+	for i := 0; i < 5; i++ {
+		clk.Advance(time.Second)
+		limiter.Observe(0, errOverloaded)
+	}
+	if limit := limiter.Limit(); limit != 10 {
+		t.Errorf("expected limit to stop at min, but received %v", limit)
+	}
+}
@@ -1,58 +1,198 @@
 package client
 
 import (
+	"code/breaker"
+	"code/chapter5/21-tieredMultiLimiter/limitConfig"
+	"code/chapter5/21-tieredMultiLimiter/limiterMetrics"
 	"code/chapter5/21-tieredMultiLimiter/multiLimiter"
 	"code/chapter5/21-tieredMultiLimiter/multiLimiterI"
 	"context"
+	"errors"
 	"golang.org/x/time/rate"
 	"time"
 )
 
+const (
+	// maxTenants 同时维护限速器的租户数上限
+	maxTenants = 1000
+	// tenantTTL 租户空闲超过此时长后 其限速器被淘汰
+	tenantTTL = 10 * time.Minute
+)
+
+// APIConnection 每个租户拥有独立的API 磁盘 网络限速器 租户之间互不影响
+// 同一租户的调用方同时等待时 交互式的ResolveAddress先于批量的ReadFile获得令牌
+// 磁盘和网络API各有一个熔断器 下游持续失败时在取令牌之前快速返回breaker.ErrOpen
 type APIConnection struct {
-	networkLimit multiLimiterI.RateLimiter
-	diskLimit    multiLimiterI.RateLimiter
-	apiLimit     multiLimiterI.RateLimiter
+	networkLimit   *multiLimiter.KeyedLimiter
+	diskLimit      *multiLimiter.KeyedLimiter
+	apiLimit       *multiLimiter.KeyedLimiter
+	gate           *multiLimiter.Gate
+	diskBreaker    *breaker.Breaker
+	networkBreaker *breaker.Breaker
+	// readFile resolveAddress 被限速和熔断保护的下游调用 其结果报告给对应的熔断器
+	readFile       func(ctx context.Context, tenantID string, cost int) error
+	resolveAddress func(ctx context.Context, tenantID string, cost int) error
 }
 
-// ReadFile 模拟读取文件 前10个请求每秒1个 从第11个开始每6秒1个 第11个请求会在第10个请求等待2s后执行
-func (a *APIConnection) ReadFile(ctx context.Context) error {
-	err := multiLimiter.NewMultiLimiter(a.apiLimit, a.diskLimit).Wait(ctx)
+// ReadFile 模拟租户tenantID读取文件 每次调用消耗1个API令牌和cost个磁盘令牌 cost通常与文件大小成正比
+// cost超过磁盘限速器的桶深时返回multiLimiter.ErrExceedsBurst 租户数达到上限时返回multiLimiter.ErrTooManyKeys
+// ctx未通过multiLimiter.WithPriority指定优先级时 以multiLimiter.PriorityBatch排队
+func (a *APIConnection) ReadFile(ctx context.Context, tenantID string, cost int) error {
+	err := a.wait(ctx, tenantID, a.diskBreaker, a.diskLimit, cost, multiLimiter.PriorityBatch)
 	if err != nil {
 		return err
 	}
 
-	// 此处假装在调用读取文件的API
-	return nil
+	err = a.readFile(ctx, tenantID, cost)
+	a.diskBreaker.Done(err)
+	return err
 }
 
-// ResolveAddress 模拟解析地址为IP 前10个请求每秒2个 从第11个开始每3秒1个 第11个请求会在第10个请求等待1s后执行
-func (a *APIConnection) ResolveAddress(ctx context.Context) error {
-	err := multiLimiter.NewMultiLimiter(a.apiLimit, a.networkLimit).Wait(ctx)
+// ResolveAddress 模拟租户tenantID解析地址为IP 每次调用消耗1个API令牌和cost个网络令牌
+// cost超过网络限速器的桶深时返回multiLimiter.ErrExceedsBurst 租户数达到上限时返回multiLimiter.ErrTooManyKeys
+// ctx未通过multiLimiter.WithPriority指定优先级时 以multiLimiter.PriorityInteractive排队
+func (a *APIConnection) ResolveAddress(ctx context.Context, tenantID string, cost int) error {
+	err := a.wait(ctx, tenantID, a.networkBreaker, a.networkLimit, cost, multiLimiter.PriorityInteractive)
 	if err != nil {
 		return err
 	}
 
-	// 此处假装在调用解析地址为IP的API
-	return nil
+	err = a.resolveAddress(ctx, tenantID, cost)
+	a.networkBreaker.Done(err)
+	return err
 }
 
-func Open() *APIConnection {
-	return &APIConnection{
-		apiLimit: multiLimiter.NewMultiLimiter(
+// wait 先经过熔断器circuit 再从租户的API限速器中取走1个令牌 同时从租户的resource限速器中取走cost个令牌
+// 返回nil时 调用方需在请求完成后调用circuit.Done报告结果
+// 熔断器打开时快速失败 不会消耗任何令牌
+func (a *APIConnection) wait(ctx context.Context, tenantID string, circuit *breaker.Breaker, resource *multiLimiter.KeyedLimiter, cost int, priority int) error {
+	limits := breaker.WaiterFunc(func(ctx context.Context) error {
+		return a.waitLimits(ctx, tenantID, resource, cost, priority)
+	})
+
+	return breaker.Chain(circuit, limits).Wait(ctx)
+}
+
+func (a *APIConnection) waitLimits(ctx context.Context, tenantID string, resource *multiLimiter.KeyedLimiter, cost int, priority int) error {
+	apiLimit, err := a.apiLimit.Get(tenantID)
+	if err != nil {
+		return err
+	}
+
+	resourceLimit, err := resource.Get(tenantID)
+	if err != nil {
+		return err
+	}
+
+	if p, ok := multiLimiter.PriorityFrom(ctx); ok {
+		priority = p
+	}
+
+	return a.gate.WaitAll(
+		ctx,
+		priority,
+		multiLimiter.Cost{Limiter: apiLimit, N: 1},
+		multiLimiter.Cost{Limiter: resourceLimit, N: cost},
+	)
+}
+
+// DefaultBreakerConfig 磁盘和网络API的熔断器配置
+// 连续失败5次 或10秒内至少10次请求中一半失败时熔断 熔断5秒后放行1个探测请求
+func DefaultBreakerConfig() breaker.Config {
+	return breaker.Config{
+		ConsecutiveFailures: 5,
+		FailureRatio:        0.5,
+		MinRequests:         10,
+		Window:              10 * time.Second,
+		CoolDown:            5 * time.Second,
+		MaxProbes:           1,
+		// 调用方自己放弃的请求不代表下游故障
+		IsFailure: func(err error) bool {
+			return err != nil && !errors.Is(err, context.Canceled)
+		},
+	}
+}
+
+// DefaultConfig 未提供配置文件时使用的限速配置
+func DefaultConfig() limitConfig.Config {
+	return limitConfig.Config{Tiers: map[string][]limitConfig.Limit{
+		"api": {
 			// API限速器1: 限制每秒最多2次访问 桶深为2
-			rate.NewLimiter(Per(2, time.Second), 2),
+			{Events: 2, Period: limitConfig.Duration(time.Second), Burst: 2},
 			// API限速器2: 限制每分钟最多10次访问 桶深为10
-			rate.NewLimiter(Per(10, time.Minute), 10),
-		),
-		diskLimit: multiLimiter.NewMultiLimiter(
-			// 磁盘访问限速器1: 限制每秒最多1次访问 桶深为1
-			rate.NewLimiter(rate.Limit(1), 1),
-		),
-		networkLimit: multiLimiter.NewMultiLimiter(
+			{Events: 10, Period: limitConfig.Duration(time.Minute), Burst: 10},
+		},
+		"disk": {
+			// 磁盘访问限速器1: 限制每秒最多读取4个单位 桶深为4 单次读取最多4个单位
+			{Events: 4, Period: limitConfig.Duration(time.Second), Burst: 4},
+		},
+		"network": {
 			// 网络访问限速器1: 限制每秒最多3次访问 桶深为3
-			rate.NewLimiter(Per(3, time.Second), 3),
-		),
+			{Events: 3, Period: limitConfig.Duration(time.Second), Burst: 3},
+		},
+	}}
+}
+
+// Open 使用DefaultConfig创建APIConnection
+func Open() *APIConnection {
+	tiers, err := limitConfig.NewTiers(DefaultConfig())
+	if err != nil {
+		panic(err)
+	}
+
+	connection, err := OpenTiers(tiers, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return connection
+}
+
+// OpenTiers 使用tiers中名为api disk network的层级创建APIConnection
+// tiers更新后 所有租户的限速器都会采用新的配置
+// registry不为nil时 每个层级的指标以层级名称记录到registry中 所有租户共享同一组指标
+func OpenTiers(tiers *limitConfig.Tiers, registry *limiterMetrics.Registry) (*APIConnection, error) {
+	apiTemplate, err := template(tiers, registry, "api")
+	if err != nil {
+		return nil, err
+	}
+
+	diskTemplate, err := template(tiers, registry, "disk")
+	if err != nil {
+		return nil, err
+	}
+
+	networkTemplate, err := template(tiers, registry, "network")
+	if err != nil {
+		return nil, err
+	}
+
+	return &APIConnection{
+		apiLimit:       multiLimiter.NewKeyedLimiter(apiTemplate, maxTenants, tenantTTL, nil),
+		diskLimit:      multiLimiter.NewKeyedLimiter(diskTemplate, maxTenants, tenantTTL, nil),
+		networkLimit:   multiLimiter.NewKeyedLimiter(networkTemplate, maxTenants, tenantTTL, nil),
+		gate:           multiLimiter.NewGate(multiLimiter.DefaultAging),
+		diskBreaker:    breaker.New(DefaultBreakerConfig()),
+		networkBreaker: breaker.New(DefaultBreakerConfig()),
+		readFile:       simulatedCall,
+		resolveAddress: simulatedCall,
+	}, nil
+}
+
+// simulatedCall 此处假装在调用读取文件或解析地址的API 调用总是成功
+func simulatedCall(ctx context.Context, _ string, _ int) error {
+	return ctx.Err()
+}
+
+func template(tiers *limitConfig.Tiers, registry *limiterMetrics.Registry, name string) (func() multiLimiterI.RateLimiter, error) {
+	newLimiter, err := tiers.Template(name)
+	if err != nil || registry == nil {
+		return newLimiter, err
 	}
+
+	return func() multiLimiterI.RateLimiter {
+		return limiterMetrics.NewInstrumented(registry, name, newLimiter())
+	}, nil
 }
 
 func Per(eventCount int, duration time.Duration) rate.Limit {
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"code/breaker"
+	"code/chapter5/21-tieredMultiLimiter/limitConfig"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// openGenerous 创建限速足够宽松的APIConnection 使测试只受熔断器影响
+func openGenerous(t *testing.T) *APIConnection {
+	t.Helper()
+
+	generous := []limitConfig.Limit{{Events: 100, Period: limitConfig.Duration(time.Hour), Burst: 100}}
+	tiers, err := limitConfig.NewTiers(limitConfig.Config{Tiers: map[string][]limitConfig.Limit{
+		"api":     generous,
+		"disk":    generous,
+		"network": generous,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connection, err := OpenTiers(tiers, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return connection
+}
+
+func TestAPIConnection_FailuresOpenBreaker(t *testing.T) {
+	connection := openGenerous(t)
+	errDisk := errors.New("disk unavailable")
+	connection.readFile = func(context.Context, string, int) error {
+		return errDisk
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := connection.ReadFile(context.Background(), "tenant", 1); err != errDisk {
+			t.Fatalf("call %v: expected %v, but received %v", i, errDisk, err)
+		}
+	}
+	if state := connection.diskBreaker.State(); state != breaker.Open {
+		t.Fatalf("expected %v, but received %v", breaker.Open, state)
+	}
+
+	apiLimit, err := connection.apiLimit.Get("tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := apiLimit.(interface{ Tokens() float64 })
+	before := tokens.Tokens()
+
+	// 熔断器打开后快速失败 不消耗API令牌
+	if err := connection.ReadFile(context.Background(), "tenant", 1); !errors.Is(err, breaker.ErrOpen) {
+		t.Errorf("expected %v, but received %v", breaker.ErrOpen, err)
+	}
+	if after := tokens.Tokens(); after < before-0.5 {
+		t.Errorf("expected no API token to be consumed, but tokens dropped from %v to %v", before, after)
+	}
+
+	// 网络API有独立的熔断器
+	if err := connection.ResolveAddress(context.Background(), "tenant", 1); err != nil {
+		t.Errorf("expected nil, but received %v", err)
+	}
+}
+
+func TestAPIConnection_CancelledCallsDoNotOpenBreaker(t *testing.T) {
+	connection := openGenerous(t)
+	connection.resolveAddress = func(context.Context, string, int) error {
+		return context.Canceled
+	}
+
+	for i := 0; i < 10; i++ {
+		connection.ResolveAddress(context.Background(), "tenant", 1)
+	}
+	if state := connection.networkBreaker.State(); state != breaker.Closed {
+		t.Errorf("expected %v, but received %v", breaker.Closed, state)
+	}
+}
@@ -0,0 +1,101 @@
+package limitConfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"golang.org/x/time/rate"
+	"os"
+	"time"
+)
+
+// Config 限速配置 由多个具名的层级组成 每个层级是一组同时生效的限速规则
+// JSON格式示例:
+//
+//	{"tiers": {"api": [{"events": 2, "period": "1s", "burst": 2}, {"events": 10, "period": "1m", "burst": 10}]}}
+type Config struct {
+	Tiers map[string][]Limit `json:"tiers"`
+}
+
+// Limit 一条限速规则 每Period最多Events个事件 桶深为Burst
+type Limit struct {
+	Events int      `json:"events"`
+	Period Duration `json:"period"`
+	Burst  int      `json:"burst"`
+}
+
+// Rate 将规则换算为rate.Limit
+func (l Limit) Rate() rate.Limit {
+	return rate.Every(time.Duration(l.Period) / time.Duration(l.Events))
+}
+
+// Duration 在JSON中以time.ParseDuration能够解析的字符串表示的时长 例如"1m30s"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("period must be a duration string: %w", err)
+	}
+
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+// Validate 检查配置中的每条规则是否合法
+func (c Config) Validate() error {
+	if len(c.Tiers) == 0 {
+		return fmt.Errorf("limitConfig: no tiers defined")
+	}
+
+	for name, limits := range c.Tiers {
+		if len(limits) == 0 {
+			return fmt.Errorf("limitConfig: tier %q has no limits", name)
+		}
+
+		for i, limit := range limits {
+			switch {
+			case limit.Events <= 0:
+				return fmt.Errorf("limitConfig: tier %q limit %d: events must be positive", name, i)
+			case limit.Period <= 0:
+				return fmt.Errorf("limitConfig: tier %q limit %d: period must be positive", name, i)
+			case limit.Burst <= 0:
+				return fmt.Errorf("limitConfig: tier %q limit %d: burst must be positive", name, i)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Parse 解析并校验JSON格式的配置
+func Parse(data []byte) (Config, error) {
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("limitConfig: %w", err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+// Load 从path读取配置
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return Parse(data)
+}
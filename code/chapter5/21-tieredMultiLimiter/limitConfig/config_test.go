@@ -0,0 +1,42 @@
+package limitConfig
+
+import (
+	"golang.org/x/time/rate"
+	"testing"
+	"time"
+)
+
+func TestParse_BuildsTiers(t *testing.T) {
+	config, err := Parse([]byte(`{"tiers": {"api": [
+		{"events": 2, "period": "1s", "burst": 2},
+		{"events": 10, "period": "1m", "burst": 10}
+	]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limits := config.Tiers["api"]
+	if len(limits) != 2 {
+		t.Fatalf("expected 2 limits, but received %v", len(limits))
+	}
+	if limits[1].Period != Duration(time.Minute) || limits[1].Burst != 10 {
+		t.Errorf("expected 10 per 1m with burst 10, but received %+v", limits[1])
+	}
+	if limit := limits[0].Rate(); limit != rate.Limit(2) {
+		t.Errorf("expected rate 2, but received %v", limit)
+	}
+}
+
+func TestParse_RejectsInvalidConfig(t *testing.T) {
+	for _, data := range []string{
+		`{"tiers": {}}`,
+		`{"tiers": {"api": []}}`,
+		`{"tiers": {"api": [{"events": 0, "period": "1s", "burst": 1}]}}`,
+		`{"tiers": {"api": [{"events": 1, "period": "soon", "burst": 1}]}}`,
+		`{"tiers": {"api": [{"events": 1, "period": "1s", "burst": 0}]}}`,
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("expected %v to be rejected", data)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package limitConfig
+
+import (
+	"code/chapter5/21-tieredMultiLimiter/multiLimiter"
+	"code/chapter5/21-tieredMultiLimiter/multiLimiterI"
+	"context"
+	"fmt"
+	"golang.org/x/time/rate"
+	"sync"
+	"time"
+)
+
+// Tiers 由Config构建的一组层级 Update可以在运行时替换配置
+// 由Limiter或Template创建的限速器在下一次被调用时采用新的配置
+type Tiers struct {
+	mu    sync.RWMutex
+	tiers map[string]*tier
+}
+
+func NewTiers(config Config) (*Tiers, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	tiers := &Tiers{tiers: make(map[string]*tier, len(config.Tiers))}
+	for name, limits := range config.Tiers {
+		tiers.tiers[name] = &tier{limits: limits}
+	}
+
+	return tiers, nil
+}
+
+// Update 替换所有层级的配置 已经存在的层级不能被删除 因为可能仍有限速器在使用它
+func (t *Tiers) Update(config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for name := range t.tiers {
+		if _, ok := config.Tiers[name]; !ok {
+			return fmt.Errorf("limitConfig: tier %q cannot be removed", name)
+		}
+	}
+
+	for name, limits := range config.Tiers {
+		if existing, ok := t.tiers[name]; ok {
+			existing.set(limits)
+			continue
+		}
+
+		t.tiers[name] = &tier{limits: limits}
+	}
+
+	return nil
+}
+
+// Limiter 创建一个遵循name层级配置的限速器
+func (t *Tiers) Limiter(name string) (multiLimiterI.RateLimiter, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	tier, ok := t.tiers[name]
+	if !ok {
+		return nil, fmt.Errorf("limitConfig: unknown tier %q", name)
+	}
+
+	return &tierLimiter{tier: tier}, nil
+}
+
+// Template 返回可以交给multiLimiter.NewKeyedLimiter的构造函数 每次调用创建一个遵循name层级配置的限速器
+func (t *Tiers) Template(name string) (func() multiLimiterI.RateLimiter, error) {
+	if _, err := t.Limiter(name); err != nil {
+		return nil, err
+	}
+
+	return func() multiLimiterI.RateLimiter {
+		limiter, _ := t.Limiter(name)
+		return limiter
+	}, nil
+}
+
+// tier 一个层级当前的规则 generation在每次更新时递增
+type tier struct {
+	mu         sync.RWMutex
+	limits     []Limit
+	generation uint64
+}
+
+func (t *tier) set(limits []Limit) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.limits = limits
+	t.generation++
+}
+
+func (t *tier) snapshot() ([]Limit, uint64) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.limits, t.generation
+}
+
+// tierLimiter 遵循某个层级配置的MultiLimiter
+// 配置更新后 规则按下标对应 已有的rate.Limiter原地修改速率和桶深 保留其中的令牌 新增的规则从空桶开始 避免重新加载配置就能获得一整桶令牌
+// 正在等待的调用方都持有原先的预留 不会被丢弃 gate在tierLimiter的整个生命周期内不变 重新加载前后的等待者仍按优先级排队
+type tierLimiter struct {
+	tier *tier
+
+	mu         sync.Mutex
+	generation uint64
+	limiters   []*multiLimiter.Limiter
+	gate       *multiLimiter.Gate
+	multi      *multiLimiter.MultiLimiter
+}
+
+func (l *tierLimiter) current() *multiLimiter.MultiLimiter {
+	limits, generation := l.tier.snapshot()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.multi != nil && l.generation == generation {
+		return l.multi
+	}
+
+	now := time.Now()
+	limiters := make([]*multiLimiter.Limiter, len(limits))
+	for i, limit := range limits {
+		if i < len(l.limiters) {
+			limiters[i] = l.limiters[i]
+			limiters[i].SetLimitAt(now, limit.Rate())
+			limiters[i].SetBurstAt(now, limit.Burst)
+			continue
+		}
+
+		limiters[i] = multiLimiter.NewLimiter(limit.Rate(), limit.Burst)
+		if l.multi != nil {
+			limiters[i].AllowN(now, limit.Burst)
+		}
+	}
+	l.limiters = limiters
+
+	if l.gate == nil {
+		l.gate = multiLimiter.NewGate(multiLimiter.DefaultAging)
+	}
+
+	children := make([]multiLimiterI.RateLimiter, len(l.limiters))
+	for i, limiter := range l.limiters {
+		children[i] = limiter
+	}
+
+	l.multi = multiLimiter.NewMultiLimiterWithGate(l.gate, children...)
+	l.generation = generation
+	return l.multi
+}
+
+func (l *tierLimiter) Wait(ctx context.Context) error {
+	return l.current().Wait(ctx)
+}
+
+func (l *tierLimiter) WaitN(ctx context.Context, n int) error {
+	return l.current().WaitN(ctx, n)
+}
+
+func (l *tierLimiter) Limit() rate.Limit {
+	return l.current().Limit()
+}
+
+func (l *tierLimiter) Burst() int {
+	return l.current().Burst()
+}
+
+func (l *tierLimiter) Tokens() float64 {
+	return l.current().Tokens()
+}
+
+func (l *tierLimiter) Allow() bool {
+	return l.current().Allow()
+}
+
+func (l *tierLimiter) AllowN(t time.Time, n int) bool {
+	return l.current().AllowN(t, n)
+}
+
+func (l *tierLimiter) Reserve() multiLimiterI.Reservation {
+	return l.current().Reserve()
+}
+
+func (l *tierLimiter) ReserveN(t time.Time, n int) multiLimiterI.Reservation {
+	return l.current().ReserveN(t, n)
+}
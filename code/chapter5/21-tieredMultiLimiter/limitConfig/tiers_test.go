@@ -0,0 +1,142 @@
+package limitConfig
+
+import (
+	"code/chapter5/21-tieredMultiLimiter/multiLimiter"
+	"context"
+	"golang.org/x/time/rate"
+	"testing"
+	"time"
+)
+
+func singleTier(events int, period time.Duration, burst int) Config {
+	return Config{Tiers: map[string][]Limit{
+		"api": {{Events: events, Period: Duration(period), Burst: burst}},
+	}}
+}
+
+func TestTiers_UpdateRaisesQuotaOfExistingLimiters(t *testing.T) {
+	tiers, err := NewTiers(singleTier(1, time.Hour, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limiter, _ := tiers.Limiter("api")
+	if !limiter.Allow() {
+		t.Fatal("expected first call to be allowed")
+	}
+	if limiter.Allow() {
+		t.Fatal("expected second call to be rejected")
+	}
+
+	if err := tiers.Update(singleTier(1000, time.Second, 5)); err != nil {
+		t.Fatal(err)
+	}
+
+	if limiter.Limit() != rate.Limit(1000) || limiter.Burst() != 5 {
+		t.Errorf("expected 1000/s with burst 5, but received %v with burst %v", limiter.Limit(), limiter.Burst())
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if !limiter.Allow() {
+		t.Error("expected raised quota to allow calls")
+	}
+}
+
+func TestTiers_UpdateDoesNotDropWaiters(t *testing.T) {
+	tiers, _ := NewTiers(singleTier(20, time.Second, 1))
+	limiter, _ := tiers.Limiter("api")
+	limiter.Allow()
+
+	waited := make(chan error)
+	go func() {
+		waited <- limiter.Wait(context.Background())
+	}()
+
+	// 等待者已经持有预留 改变规则的数量会重建MultiLimiter 但不影响等待者
+	time.Sleep(10 * time.Millisecond)
+	config := singleTier(20, time.Second, 1)
+	config.Tiers["api"] = append(config.Tiers["api"], Limit{Events: 100, Period: Duration(time.Second), Burst: 10})
+	if err := tiers.Update(config); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Errorf("expected waiter to be served, but received %v", err)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("waiter was dropped")
+	}
+
+	if limiter.Burst() != 1 {
+		t.Errorf("expected burst 1 from the rebuilt tier, but received %v", limiter.Burst())
+	}
+}
+
+func TestTiers_UpdateDoesNotRefillTokens(t *testing.T) {
+	tiers, _ := NewTiers(singleTier(1, time.Hour, 5))
+	limiter, _ := tiers.Limiter("api")
+	if !limiter.AllowN(time.Now(), 5) {
+		t.Fatal("expected the full burst to be allowed")
+	}
+
+	// 新增一条规则 已有的规则保留被消耗的令牌 新增的规则从空桶开始
+	config := singleTier(1, time.Hour, 5)
+	config.Tiers["api"] = append(config.Tiers["api"], Limit{Events: 1, Period: Duration(time.Hour), Burst: 5})
+	if err := tiers.Update(config); err != nil {
+		t.Fatal(err)
+	}
+	if limiter.Allow() {
+		t.Error("expected adding a limit not to refill the drained tier")
+	}
+
+	// 删除一条规则 剩下的规则仍然保留被消耗的令牌
+	if err := tiers.Update(singleTier(1, time.Hour, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if limiter.Allow() {
+		t.Error("expected removing a limit not to refill the drained tier")
+	}
+}
+
+func TestTiers_UpdateKeepsPriorityOrder(t *testing.T) {
+	tiers, _ := NewTiers(singleTier(20, time.Second, 1))
+	limiter, _ := tiers.Limiter("api")
+	limiter.Allow()
+
+	order := make(chan int, 2)
+	go func() {
+		if err := limiter.Wait(multiLimiter.WithPriority(context.Background(), multiLimiter.PriorityBatch)); err == nil {
+			order <- multiLimiter.PriorityBatch
+		}
+	}()
+
+	// 批处理的等待者持有预留后重新加载配置 之后到来的交互式等待者仍然可以抢占它
+	time.Sleep(10 * time.Millisecond)
+	if err := tiers.Update(singleTier(20, time.Second, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Wait(multiLimiter.WithPriority(context.Background(), multiLimiter.PriorityInteractive)); err == nil {
+		order <- multiLimiter.PriorityInteractive
+	}
+
+	if first := <-order; first != multiLimiter.PriorityInteractive {
+		t.Errorf("expected %v, but received %v", multiLimiter.PriorityInteractive, first)
+	}
+	<-order
+}
+
+func TestTiers_UpdateRejectsRemovedTier(t *testing.T) {
+	tiers, _ := NewTiers(Config{Tiers: map[string][]Limit{
+		"api":  {{Events: 1, Period: Duration(time.Second), Burst: 1}},
+		"disk": {{Events: 1, Period: Duration(time.Second), Burst: 1}},
+	}})
+
+	if err := tiers.Update(singleTier(1, time.Second, 1)); err == nil {
+		t.Error("expected removing tier disk to be rejected")
+	}
+	if _, err := tiers.Limiter("disk"); err != nil {
+		t.Errorf("expected tier disk to survive a rejected update, but received %v", err)
+	}
+}
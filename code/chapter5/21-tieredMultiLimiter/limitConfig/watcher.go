@@ -0,0 +1,56 @@
+package limitConfig
+
+import (
+	"bytes"
+	"code/clock"
+	"os"
+	"time"
+)
+
+// Watch 每隔interval读取一次path 内容发生变化时解析并应用到tiers
+// 读取或解析失败时保留原先的配置 并将错误发送到返回的channel 调用方来不及接收的错误会被丢弃
+// 同样内容的非法配置只报告一次
+// done关闭后停止监视并关闭返回的channel clk为nil时使用真实时钟
+func Watch(done <-chan interface{}, path string, tiers *Tiers, interval time.Duration, clk clock.Clock) <-chan error {
+	clk = clock.OrReal(clk)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+
+		ticker := clk.NewTicker(interval)
+		defer ticker.Stop()
+
+		var last []byte
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C():
+			}
+
+			data, err := os.ReadFile(path)
+			if err == nil && bytes.Equal(data, last) {
+				continue
+			}
+
+			if err == nil {
+				last = data
+
+				var config Config
+				if config, err = Parse(data); err == nil {
+					err = tiers.Update(config)
+				}
+			}
+
+			if err != nil {
+				select {
+				case errs <- err:
+				default:
+				}
+			}
+		}
+	}()
+
+	return errs
+}
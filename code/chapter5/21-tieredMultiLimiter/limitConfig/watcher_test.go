@@ -0,0 +1,66 @@
+package limitConfig
+
+import (
+	"code/clock"
+	"golang.org/x/time/rate"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitFor 轮询condition 直到其返回true或超时
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(1 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+func TestWatch_ReloadsChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.json")
+	write := func(data string) {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"tiers": {"api": [{"events": 1, "period": "1s", "burst": 1}]}}`)
+	config, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tiers, _ := NewTiers(config)
+	limiter, _ := tiers.Limiter("api")
+
+	clk := clock.NewFake(time.Unix(0, 0))
+	done := make(chan interface{})
+	defer close(done)
+	errs := Watch(done, path, tiers, time.Second, clk)
+
+	write(`{"tiers": {"api": [{"events": 5, "period": "1s", "burst": 5}]}}`)
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	waitFor(t, func() bool { return limiter.Limit() == rate.Limit(5) })
+
+	// 非法的配置被报告 原先的配置保持不变
+	write(`{"tiers": {"api": [{"events": 5, "period": "1s", "burst": 0}]}}`)
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("expected a reload error")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("expected invalid config to be reported")
+	}
+	if limiter.Burst() != 5 {
+		t.Errorf("expected burst 5 to be kept, but received %v", limiter.Burst())
+	}
+}
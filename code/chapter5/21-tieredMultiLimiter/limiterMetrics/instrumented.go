@@ -0,0 +1,190 @@
+package limiterMetrics
+
+import (
+	"code/chapter5/21-tieredMultiLimiter/multiLimiter"
+	"code/chapter5/21-tieredMultiLimiter/multiLimiterI"
+	"context"
+	"errors"
+	"golang.org/x/time/rate"
+	"sync/atomic"
+	"time"
+)
+
+// 拒绝的原因
+const (
+	// ReasonDenied Allow/AllowN返回false 或预留失败
+	ReasonDenied = "denied"
+	// ReasonBurst 请求的令牌数超过桶深
+	ReasonBurst = "burst"
+	// ReasonCanceled Wait期间ctx被取消
+	ReasonCanceled = "canceled"
+	// ReasonDeadline ctx的截止时间已到 或在截止时间前无法获得令牌
+	ReasonDeadline = "deadline"
+	// ReasonAbandoned 预留未报告等待结果就被取消 例如其他限速器拒绝了请求
+	ReasonAbandoned = "abandoned"
+	// ReasonError 其他错误 例如共享存储不可用
+	ReasonError = "error"
+)
+
+// Instrumented 记录限速器指标的装饰器 满足multiLimiterI.RateLimiter接口
+type Instrumented struct {
+	limiter  multiLimiterI.RateLimiter
+	metrics  *limiterMetrics
+	instance int
+}
+
+var _ multiLimiterI.RateLimiter = (*Instrumented)(nil)
+
+// NewInstrumented 将limiter的指标以name记录到registry中
+// limiter实现了Tokens() float64时 导出其当前令牌数 直到Close被调用
+func NewInstrumented(registry *Registry, name string, limiter multiLimiterI.RateLimiter) *Instrumented {
+	var tokens func() float64
+	if t, ok := limiter.(interface{ Tokens() float64 }); ok {
+		tokens = t.Tokens
+	}
+
+	metrics, instance := registry.register(name, tokens)
+	return &Instrumented{limiter: limiter, metrics: metrics, instance: instance}
+}
+
+// Close 不再导出该限速器的令牌数 已经记录的其他指标保留 multiLimiter.KeyedLimiter淘汰限速器时调用
+func (i *Instrumented) Close() {
+	i.metrics.unregister(i.instance)
+}
+
+func (i *Instrumented) Wait(ctx context.Context) error {
+	return i.WaitN(ctx, 1)
+}
+
+func (i *Instrumented) WaitN(ctx context.Context, n int) error {
+	if n > i.limiter.Burst() && i.limiter.Limit() != rate.Inf {
+		i.metrics.reject(ReasonBurst)
+		return i.limiter.WaitN(ctx, n)
+	}
+
+	start := time.Now()
+	err := i.limiter.WaitN(ctx, n)
+	i.metrics.observeWait(time.Since(start))
+
+	if err != nil {
+		i.metrics.reject(reason(ctx, err))
+		return err
+	}
+
+	i.metrics.grant(n)
+	return nil
+}
+
+// ObserveWait 记录在multiLimiter.Gate中排队 尚未预留就失败的等待
+func (i *Instrumented) ObserveWait(wait time.Duration, err error) {
+	i.metrics.observeWait(wait)
+	if err != nil {
+		i.metrics.reject(reason(nil, err))
+	}
+}
+
+func (i *Instrumented) Limit() rate.Limit {
+	return i.limiter.Limit()
+}
+
+func (i *Instrumented) Burst() int {
+	return i.limiter.Burst()
+}
+
+func (i *Instrumented) Allow() bool {
+	return i.AllowN(time.Now(), 1)
+}
+
+func (i *Instrumented) AllowN(t time.Time, n int) bool {
+	if !i.limiter.AllowN(t, n) {
+		i.metrics.reject(ReasonDenied)
+		return false
+	}
+
+	i.metrics.grant(n)
+	return true
+}
+
+func (i *Instrumented) Reserve() multiLimiterI.Reservation {
+	return i.ReserveN(time.Now(), 1)
+}
+
+// ReserveN 记录该限速器要求的等待时长 与其他限速器组合时 可以据此找出瓶颈
+// 预留在被使用时才计入发放的令牌数 返回的预留实现了multiLimiterI.WaitObserver
+// multiLimiter.WaitAll和Gate.WaitAll通过它记录等待的时长和结果 直接使用预留的调用方应在等待结束后调用ObserveWait
+func (i *Instrumented) ReserveN(t time.Time, n int) multiLimiterI.Reservation {
+	reservation := i.limiter.ReserveN(t, n)
+	if !reservation.OK() {
+		i.metrics.reject(ReasonDenied)
+		return reservation
+	}
+
+	i.metrics.observeReserve(reservation.DelayFrom(t))
+	return &instrumentedReservation{Reservation: reservation, metrics: i.metrics, tokens: n}
+}
+
+// instrumentedReservation 等待结束时记录等待的时长和结果 未报告结果就被取消时记录一次ReasonAbandoned
+// 被multiLimiter.Gate抢占时不记录 等待者重新预留后才有最终的结果
+type instrumentedReservation struct {
+	multiLimiterI.Reservation
+	metrics *limiterMetrics
+	tokens  int
+	// settled 已经记录过结果 之后的ObserveWait和Cancel不再记录
+	settled atomic.Bool
+}
+
+func (r *instrumentedReservation) ObserveWait(wait time.Duration, err error) {
+	if !r.settled.CompareAndSwap(false, true) {
+		return
+	}
+
+	r.metrics.observeWait(wait)
+	if err != nil {
+		r.metrics.reject(reason(nil, err))
+		return
+	}
+	r.metrics.grant(r.tokens)
+}
+
+func (r *instrumentedReservation) Cancel() {
+	if r.settled.CompareAndSwap(false, true) {
+		r.metrics.reject(ReasonAbandoned)
+	}
+	r.Reservation.Cancel()
+}
+
+func (r *instrumentedReservation) CancelAt(t time.Time) {
+	if r.settled.CompareAndSwap(false, true) {
+		r.metrics.reject(ReasonAbandoned)
+	}
+	r.Reservation.CancelAt(t)
+}
+
+// Release 归还令牌但不记录结果
+func (r *instrumentedReservation) Release(t time.Time) {
+	if releaser, ok := r.Reservation.(multiLimiterI.Releaser); ok {
+		releaser.Release(t)
+		return
+	}
+	r.Reservation.CancelAt(t)
+}
+
+func reason(ctx context.Context, err error) string {
+	switch {
+	case errors.Is(err, multiLimiter.ErrExceedsBurst):
+		return ReasonBurst
+	case errors.Is(err, context.Canceled):
+		return ReasonCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ReasonDeadline
+	}
+
+	// rate.Limiter在截止时间前无法获得令牌时 返回的错误不包装context.DeadlineExceeded
+	if ctx != nil {
+		if _, ok := ctx.Deadline(); ok {
+			return ReasonDeadline
+		}
+	}
+
+	return ReasonError
+}
@@ -0,0 +1,256 @@
+package limiterMetrics
+
+import (
+	"code/chapter5/21-tieredMultiLimiter/multiLimiter"
+	"context"
+	"fmt"
+	"golang.org/x/time/rate"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scrape 通过HTTP获取registry导出的指标
+func scrape(t *testing.T, registry *Registry) string {
+	t.Helper()
+
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
+
+func expectLine(t *testing.T, metrics, line string) {
+	t.Helper()
+
+	if !strings.Contains(metrics, line+"\n") {
+		t.Errorf("expected metrics to contain %q, but received:\n%v", line, metrics)
+	}
+}
+
+func TestInstrumented_RecordsGrantsAndRejections(t *testing.T) {
+	registry := NewRegistry([]float64{0.01, 1})
+	limiter := NewInstrumented(registry, "api", multiLimiter.NewLimiter(rate.Every(time.Hour), 2))
+
+	if err := limiter.WaitN(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	limiter.Allow()
+	limiter.WaitN(context.Background(), 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	limiter.Wait(ctx)
+
+	metrics := scrape(t, registry)
+	expectLine(t, metrics, `ratelimiter_tokens_granted_total{limiter="api"} 2`)
+	expectLine(t, metrics, `ratelimiter_rejections_total{limiter="api",reason="burst"} 1`)
+	expectLine(t, metrics, `ratelimiter_rejections_total{limiter="api",reason="deadline"} 1`)
+	expectLine(t, metrics, `ratelimiter_rejections_total{limiter="api",reason="denied"} 1`)
+	expectLine(t, metrics, `ratelimiter_wait_seconds_bucket{limiter="api",le="0.01"} 2`)
+	expectLine(t, metrics, `ratelimiter_wait_seconds_count{limiter="api"} 2`)
+	if !strings.Contains(metrics, `ratelimiter_tokens{limiter="api"} `) {
+		t.Errorf("expected a tokens gauge, but received:\n%v", metrics)
+	}
+}
+
+func TestInstrumented_ShowsBottleneckTier(t *testing.T) {
+	registry := NewRegistry([]float64{0.5, 10})
+	api := NewInstrumented(registry, "api", multiLimiter.NewLimiter(rate.Limit(100), 10))
+	disk := NewInstrumented(registry, "disk", multiLimiter.NewLimiter(rate.Every(time.Second), 1))
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		multiLimiter.WaitAll(ctx, multiLimiter.Cost{Limiter: api, N: 1}, multiLimiter.Cost{Limiter: disk, N: 1})
+		cancel()
+	}
+
+	// 只有第1次请求立即执行 之后disk要求等待约1s 因此disk的预留等待时长超过0.5s
+	metrics := scrape(t, registry)
+	expectLine(t, metrics, `ratelimiter_reserve_delay_seconds_bucket{limiter="api",le="0.5"} 3`)
+	expectLine(t, metrics, `ratelimiter_reserve_delay_seconds_bucket{limiter="disk",le="0.5"} 1`)
+	// 之后的2次请求因截止时间而失败 两个层级都记录为deadline 令牌只在第1次请求中被使用
+	expectLine(t, metrics, `ratelimiter_rejections_total{limiter="disk",reason="deadline"} 2`)
+	expectLine(t, metrics, `ratelimiter_rejections_total{limiter="api",reason="deadline"} 2`)
+	expectLine(t, metrics, `ratelimiter_tokens_granted_total{limiter="api"} 1`)
+	expectLine(t, metrics, `ratelimiter_tokens_granted_total{limiter="disk"} 1`)
+	expectLine(t, metrics, `ratelimiter_wait_seconds_count{limiter="disk"} 3`)
+}
+
+func TestInstrumented_RecordsOutcomeOfWaitAll(t *testing.T) {
+	registry := NewRegistry([]float64{0.01, 1})
+	disk := NewInstrumented(registry, "disk", multiLimiter.NewLimiter(rate.Every(50*time.Millisecond), 1))
+
+	// 第1次立即获得令牌 第2次等待约50ms后获得令牌
+	for i := 0; i < 2; i++ {
+		if err := multiLimiter.WaitAll(context.Background(), multiLimiter.Cost{Limiter: disk, N: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 等待期间ctx被取消
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if err := multiLimiter.WaitAll(ctx, multiLimiter.Cost{Limiter: disk, N: 1}); err != context.Canceled {
+		t.Errorf("expected %v, but received %v", context.Canceled, err)
+	}
+
+	// 预留后未等待就被取消
+	disk.Reserve().Cancel()
+
+	metrics := scrape(t, registry)
+	expectLine(t, metrics, `ratelimiter_tokens_granted_total{limiter="disk"} 2`)
+	expectLine(t, metrics, `ratelimiter_rejections_total{limiter="disk",reason="canceled"} 1`)
+	expectLine(t, metrics, `ratelimiter_rejections_total{limiter="disk",reason="abandoned"} 1`)
+	expectLine(t, metrics, `ratelimiter_wait_seconds_count{limiter="disk"} 3`)
+	expectLine(t, metrics, `ratelimiter_wait_seconds_bucket{limiter="disk",le="0.01"} 1`)
+}
+
+func TestRegistry_EscapesLabelsForPrometheus(t *testing.T) {
+	registry := NewRegistry(nil)
+	limiter := NewInstrumented(registry, "disk \"\\\"\tsdé\n", multiLimiter.NewLimiter(rate.Inf, 1))
+	limiter.Allow()
+
+	// 只转义反斜杠 双引号和换行 制表符和非ASCII字符原样输出
+	metrics := scrape(t, registry)
+	expectLine(t, metrics, "ratelimiter_tokens_granted_total{limiter=\"disk \\\"\\\\\\\"\tsdé\\n\"} 1")
+	expectLine(t, metrics, "ratelimiter_wait_seconds_count{limiter=\"disk \\\"\\\\\\\"\tsdé\\n\"} 0")
+}
+
+func TestRegistry_ExportsLeastTokensForSharedNames(t *testing.T) {
+	registry := NewRegistry(nil)
+	busy := NewInstrumented(registry, "api", multiLimiter.NewLimiter(rate.Every(time.Hour), 5))
+	NewInstrumented(registry, "api", multiLimiter.NewLimiter(rate.Every(time.Hour), 5))
+	busy.AllowN(time.Now(), 3)
+
+	if metrics := scrape(t, registry); !strings.Contains(metrics, `ratelimiter_tokens{limiter="api"} 2`) {
+		t.Errorf("expected the tokens of the busiest limiter, but received:\n%v", metrics)
+	}
+
+	// 被关闭的限速器不再计入令牌数 例如被KeyedLimiter淘汰的租户
+	busy.Close()
+	expectLine(t, scrape(t, registry), `ratelimiter_tokens{limiter="api"} 5`)
+}
+
+func TestRegistry_ExportWhileRegistering(t *testing.T) {
+	registry := NewRegistry(nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			NewInstrumented(registry, fmt.Sprintf("tier-%d", i), multiLimiter.NewLimiter(rate.Limit(1), 1))
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			registry.WriteTo(io.Discard)
+		}
+	}
+}
+
+func TestInstrumented_GateWaitsRecordOnlyRealOutcomes(t *testing.T) {
+	registry := NewRegistry([]float64{0.01, 1})
+	api := NewInstrumented(registry, "api", multiLimiter.NewLimiter(rate.Every(10*time.Millisecond), 1))
+	network := NewInstrumented(registry, "network", multiLimiter.NewLimiter(rate.Every(20*time.Millisecond), 2))
+	g := multiLimiter.NewGate(multiLimiter.DefaultAging)
+
+	const calls = 6
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := g.WaitAll(context.Background(), multiLimiter.PriorityInteractive, multiLimiter.Cost{Limiter: api, N: 1}, multiLimiter.Cost{Limiter: network, N: 1})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 排队期间不应为了得知等待时长而反复预留和取消令牌 优先级相同时也不会发生抢占
+	metrics := scrape(t, registry)
+	expectLine(t, metrics, fmt.Sprintf(`ratelimiter_tokens_granted_total{limiter="api"} %d`, calls))
+	expectLine(t, metrics, fmt.Sprintf(`ratelimiter_tokens_granted_total{limiter="network"} %d`, calls))
+	expectLine(t, metrics, fmt.Sprintf(`ratelimiter_wait_seconds_count{limiter="api"} %d`, calls))
+	if strings.Contains(metrics, `reason="abandoned"`) {
+		t.Errorf("expected no abandoned reservations without preemption, but received:\n%v", metrics)
+	}
+}
+
+func TestInstrumented_RecordsOutcomeOfGateWait(t *testing.T) {
+	registry := NewRegistry([]float64{0.01, 1})
+	disk := NewInstrumented(registry, "disk", multiLimiter.NewLimiter(rate.Every(50*time.Millisecond), 1))
+	g := multiLimiter.NewGate(multiLimiter.DefaultAging)
+
+	if err := g.WaitAll(context.Background(), multiLimiter.PriorityBatch, multiLimiter.Cost{Limiter: disk, N: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 持有预留时ctx被取消
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if err := g.WaitAll(ctx, multiLimiter.PriorityBatch, multiLimiter.Cost{Limiter: disk, N: 1}); err != context.Canceled {
+		t.Errorf("expected %v, but received %v", context.Canceled, err)
+	}
+
+	// 需要等待的时长超过截止时间
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if err := g.WaitAll(ctx, multiLimiter.PriorityBatch, multiLimiter.Cost{Limiter: disk, N: 1}); err == nil {
+		t.Error("expected wait past the deadline to fail")
+	}
+
+	metrics := scrape(t, registry)
+	expectLine(t, metrics, `ratelimiter_tokens_granted_total{limiter="disk"} 1`)
+	expectLine(t, metrics, `ratelimiter_rejections_total{limiter="disk",reason="canceled"} 1`)
+	expectLine(t, metrics, `ratelimiter_rejections_total{limiter="disk",reason="deadline"} 1`)
+	expectLine(t, metrics, `ratelimiter_wait_seconds_count{limiter="disk"} 3`)
+}
+
+func TestInstrumented_PreemptedGateWaitRecordsOnlyFinalOutcome(t *testing.T) {
+	registry := NewRegistry(nil)
+	disk := NewInstrumented(registry, "disk", multiLimiter.NewLimiter(rate.Every(50*time.Millisecond), 1))
+	g := multiLimiter.NewGate(multiLimiter.DefaultAging)
+	disk.Allow()
+
+	batch := make(chan error, 1)
+	go func() {
+		batch <- g.WaitAll(context.Background(), multiLimiter.PriorityBatch, multiLimiter.Cost{Limiter: disk, N: 1})
+	}()
+
+	// 等批处理的等待者持有预留后 交互式的等待者抢占它
+	time.Sleep(10 * time.Millisecond)
+	if err := g.WaitAll(context.Background(), multiLimiter.PriorityInteractive, multiLimiter.Cost{Limiter: disk, N: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-batch; err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := scrape(t, registry)
+	expectLine(t, metrics, `ratelimiter_tokens_granted_total{limiter="disk"} 3`)
+	expectLine(t, metrics, `ratelimiter_wait_seconds_count{limiter="disk"} 2`)
+	if strings.Contains(metrics, `reason="abandoned"`) {
+		t.Errorf("expected a preempted wait that later succeeded not to be reported as abandoned, but received:\n%v", metrics)
+	}
+}
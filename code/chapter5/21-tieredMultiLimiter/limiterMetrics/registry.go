@@ -0,0 +1,267 @@
+package limiterMetrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets 等待时长直方图的默认桶 单位为秒
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60}
+
+// Registry 保存所有被观测的限速器的指标 并以Prometheus文本格式导出
+// 同名的Instrumented共享同一组指标 例如同一层级下每个租户的限速器 此时令牌数为其中最少的令牌数 即最接近被限速的租户
+type Registry struct {
+	buckets []float64
+
+	mu       sync.Mutex
+	limiters map[string]*limiterMetrics
+}
+
+// NewRegistry buckets为nil时使用DefaultBuckets
+func NewRegistry(buckets []float64) *Registry {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+
+	return &Registry{buckets: buckets, limiters: make(map[string]*limiterMetrics)}
+}
+
+// limiterMetrics 一个限速器名称下的所有指标
+type limiterMetrics struct {
+	mu sync.Mutex
+	// wait 调用方在Wait中实际阻塞的时长
+	wait histogram
+	// reserveDelay 预留时该限速器要求的等待时长 与其他限速器组合使用时 该值最大的限速器就是瓶颈
+	reserveDelay histogram
+	granted      float64
+	rejections   map[string]float64
+
+	// tokens 使用该名称且能够报告令牌数的每个Instrumented的令牌数 以register返回的编号为key
+	tokens       map[int]func() float64
+	nextInstance int
+}
+
+// register 返回name对应的指标 tokens不为nil时将其计入令牌数 返回的instance用于unregister
+func (r *Registry) register(name string, tokens func() float64) (metrics *limiterMetrics, instance int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	metrics, ok := r.limiters[name]
+	if !ok {
+		metrics = &limiterMetrics{
+			wait:         newHistogram(r.buckets),
+			reserveDelay: newHistogram(r.buckets),
+			rejections:   make(map[string]float64),
+			tokens:       make(map[int]func() float64),
+		}
+		r.limiters[name] = metrics
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	metrics.nextInstance++
+	if tokens != nil {
+		metrics.tokens[metrics.nextInstance] = tokens
+	}
+
+	return metrics, metrics.nextInstance
+}
+
+// unregister 不再将instance的令牌数计入该名称的令牌数
+func (m *limiterMetrics) unregister(instance int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.tokens, instance)
+}
+
+func (m *limiterMetrics) observeWait(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.wait.observe(d.Seconds())
+}
+
+func (m *limiterMetrics) observeReserve(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.reserveDelay.observe(d.Seconds())
+}
+
+func (m *limiterMetrics) grant(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.granted += float64(n)
+}
+
+func (m *limiterMetrics) reject(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rejections[reason]++
+}
+
+// ServeHTTP 以Prometheus文本格式输出所有指标
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// WriteTo 以Prometheus文本格式将所有指标写入w
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	// 持有锁时复制名称和指标 register可能在导出期间向r.limiters中添加新的名称
+	r.mu.Lock()
+	names := make([]string, 0, len(r.limiters))
+	limiters := make(map[string]*limiterMetrics, len(r.limiters))
+	for name, m := range r.limiters {
+		names = append(names, name)
+		limiters[name] = m
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	out := &countingWriter{w: w}
+
+	out.printf("# HELP ratelimiter_wait_seconds Time callers were blocked in Wait.\n")
+	out.printf("# TYPE ratelimiter_wait_seconds histogram\n")
+	for _, name := range names {
+		m := limiters[name]
+		m.mu.Lock()
+		m.wait.write(out, "ratelimiter_wait_seconds", name)
+		m.mu.Unlock()
+	}
+
+	out.printf("# HELP ratelimiter_reserve_delay_seconds Delay imposed by the limiter on each reservation.\n")
+	out.printf("# TYPE ratelimiter_reserve_delay_seconds histogram\n")
+	for _, name := range names {
+		m := limiters[name]
+		m.mu.Lock()
+		m.reserveDelay.write(out, "ratelimiter_reserve_delay_seconds", name)
+		m.mu.Unlock()
+	}
+
+	out.printf("# HELP ratelimiter_tokens_granted_total Tokens granted by the limiter.\n")
+	out.printf("# TYPE ratelimiter_tokens_granted_total counter\n")
+	for _, name := range names {
+		m := limiters[name]
+		m.mu.Lock()
+		out.printf("ratelimiter_tokens_granted_total{limiter=\"%s\"} %s\n", escapeLabel(name), formatFloat(m.granted))
+		m.mu.Unlock()
+	}
+
+	out.printf("# HELP ratelimiter_rejections_total Calls rejected by the limiter, by reason.\n")
+	out.printf("# TYPE ratelimiter_rejections_total counter\n")
+	for _, name := range names {
+		m := limiters[name]
+		m.mu.Lock()
+		reasons := make([]string, 0, len(m.rejections))
+		for reason := range m.rejections {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+		for _, reason := range reasons {
+			out.printf("ratelimiter_rejections_total{limiter=\"%s\",reason=\"%s\"} %s\n", escapeLabel(name), escapeLabel(reason), formatFloat(m.rejections[reason]))
+		}
+		m.mu.Unlock()
+	}
+
+	out.printf("# HELP ratelimiter_tokens Tokens currently available in the limiter, the minimum across all limiters sharing the name.\n")
+	out.printf("# TYPE ratelimiter_tokens gauge\n")
+	for _, name := range names {
+		m := limiters[name]
+		m.mu.Lock()
+		tokens := make([]func() float64, 0, len(m.tokens))
+		for _, t := range m.tokens {
+			tokens = append(tokens, t)
+		}
+		m.mu.Unlock()
+
+		// 在锁外读取令牌数 读取时需要获取限速器自己的锁
+		if len(tokens) > 0 {
+			least := math.Inf(1)
+			for _, t := range tokens {
+				least = math.Min(least, t())
+			}
+			out.printf("ratelimiter_tokens{limiter=\"%s\"} %s\n", escapeLabel(name), formatFloat(least))
+		}
+	}
+
+	return out.n, out.err
+}
+
+// histogram 累积直方图 counts[i]为不大于buckets[i]的观测值个数
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) histogram {
+	return histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(out *countingWriter, metric, name string) {
+	name = escapeLabel(name)
+	for i, bound := range h.buckets {
+		out.printf("%s_bucket{limiter=\"%s\",le=\"%s\"} %d\n", metric, name, formatFloat(bound), h.counts[i])
+	}
+	out.printf("%s_bucket{limiter=\"%s\",le=\"+Inf\"} %d\n", metric, name, h.count)
+	out.printf("%s_sum{limiter=\"%s\"} %s\n", metric, name, formatFloat(h.sum))
+	out.printf("%s_count{limiter=\"%s\"} %d\n", metric, name, h.count)
+}
+
+// labelEscaper Prometheus文本格式中的标签值只需转义反斜杠 双引号和换行 其余字符按UTF-8原样输出
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter 记录写入的字节数和第一个错误 出错后不再写入
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) printf(format string, args ...interface{}) {
+	if c.err != nil {
+		return
+	}
+
+	n, err := fmt.Fprintf(c.w, format, args...)
+	c.n += int64(n)
+	c.err = err
+}
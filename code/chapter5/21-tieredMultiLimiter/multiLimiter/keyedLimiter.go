@@ -0,0 +1,98 @@
+package multiLimiter
+
+import (
+	"code/chapter5/21-tieredMultiLimiter/multiLimiterI"
+	"code/clock"
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrTooManyKeys KeyedLimiter中的key已达上限 且没有空闲超过ttl的key可以淘汰
+var ErrTooManyKeys = errors.New("multiLimiter: too many keys")
+
+// KeyedLimiter 为每个key(例如每个租户)单独维护一个限速器 限速器在key第一次出现时由newLimiter创建
+// 空闲超过ttl的key按最久未使用的顺序被淘汰 被淘汰的限速器实现了Close()时调用它 key的数量达到maxKeys且没有可以淘汰的key时 拒绝创建新的key
+// 未过期的key不会因为容量而被淘汰 否则租户可以通过制造大量新key使其他租户的限速器被重置
+type KeyedLimiter struct {
+	newLimiter func() multiLimiterI.RateLimiter
+	maxKeys    int
+	ttl        time.Duration
+	clk        clock.Clock
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru 按最近使用时间排序 最近使用的在前
+	lru *list.List
+}
+
+type keyedEntry struct {
+	key      string
+	limiter  multiLimiterI.RateLimiter
+	lastUsed time.Time
+}
+
+// NewKeyedLimiter maxKeys<=0表示不限制key的数量 ttl<=0表示key永不过期 clk为nil时使用真实时钟
+func NewKeyedLimiter(newLimiter func() multiLimiterI.RateLimiter, maxKeys int, ttl time.Duration, clk clock.Clock) *KeyedLimiter {
+	return &KeyedLimiter{
+		newLimiter: newLimiter,
+		maxKeys:    maxKeys,
+		ttl:        ttl,
+		clk:        clock.OrReal(clk),
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Get 返回key对应的限速器 key不存在时创建
+func (k *KeyedLimiter) Get(key string) (multiLimiterI.RateLimiter, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.clk.Now()
+	k.evictExpiredLocked(now)
+
+	if element, ok := k.entries[key]; ok {
+		entry := element.Value.(*keyedEntry)
+		entry.lastUsed = now
+		k.lru.MoveToFront(element)
+		return entry.limiter, nil
+	}
+
+	if k.maxKeys > 0 && len(k.entries) >= k.maxKeys {
+		return nil, ErrTooManyKeys
+	}
+
+	entry := &keyedEntry{key: key, limiter: k.newLimiter(), lastUsed: now}
+	k.entries[key] = k.lru.PushFront(entry)
+	return entry.limiter, nil
+}
+
+// Len 当前维护的key的数量
+func (k *KeyedLimiter) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return len(k.entries)
+}
+
+// evictExpiredLocked 从最久未使用的key开始淘汰空闲超过ttl的key
+func (k *KeyedLimiter) evictExpiredLocked(now time.Time) {
+	if k.ttl <= 0 {
+		return
+	}
+
+	for element := k.lru.Back(); element != nil; element = k.lru.Back() {
+		entry := element.Value.(*keyedEntry)
+		if now.Sub(entry.lastUsed) < k.ttl {
+			return
+		}
+
+		k.lru.Remove(element)
+		delete(k.entries, entry.key)
+		if closer, ok := entry.limiter.(interface{ Close() }); ok {
+			closer.Close()
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package multiLimiter
+
+import (
+	"code/chapter5/21-tieredMultiLimiter/multiLimiterI"
+	"code/clock"
+	"errors"
+	"golang.org/x/time/rate"
+	"testing"
+	"time"
+)
+
+func newTestKeyedLimiter(maxKeys int, ttl time.Duration, clk clock.Clock) *KeyedLimiter {
+	return NewKeyedLimiter(func() multiLimiterI.RateLimiter {
+		return NewMultiLimiter(NewLimiter(rate.Every(time.Hour), 1))
+	}, maxKeys, ttl, clk)
+}
+
+func TestKeyedLimiter_KeysHaveIndependentBudgets(t *testing.T) {
+	k := newTestKeyedLimiter(0, 0, nil)
+
+	a, _ := k.Get("a")
+	b, _ := k.Get("b")
+	if !a.Allow() || !b.Allow() {
+		t.Fatal("expected first call of each key to be allowed")
+	}
+
+	again, _ := k.Get("a")
+	if again.Allow() {
+		t.Error("expected key a to reuse its exhausted limiter")
+	}
+}
+
+func TestKeyedLimiter_EvictsIdleKeysAfterTTL(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	k := newTestKeyedLimiter(0, time.Minute, clk)
+
+	k.Get("idle")
+	clk.Advance(30 * time.Second)
+	k.Get("busy")
+	clk.Advance(40 * time.Second)
+	k.Get("busy")
+
+	if k.Len() != 1 {
+		t.Errorf("expected idle key to be evicted, but %v keys left", k.Len())
+	}
+}
+
+func TestKeyedLimiter_RejectsNewKeysAtCapacity(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	k := newTestKeyedLimiter(2, time.Minute, clk)
+
+	k.Get("a")
+	k.Get("b")
+	if _, err := k.Get("c"); !errors.Is(err, ErrTooManyKeys) {
+		t.Fatalf("expected %v, but received %v", ErrTooManyKeys, err)
+	}
+
+	// a被使用过 b成为最久未使用的key 过期后让位给c
+	clk.Advance(50 * time.Second)
+	k.Get("a")
+	clk.Advance(20 * time.Second)
+	if _, err := k.Get("c"); err != nil {
+		t.Fatalf("expected expired key to make room, but received %v", err)
+	}
+	if _, err := k.Get("b"); !errors.Is(err, ErrTooManyKeys) {
+		t.Errorf("expected b to have been evicted and capacity reached, but received %v", err)
+	}
+}
+
+// closingLimiter 记录是否被关闭的限速器
+type closingLimiter struct {
+	*MultiLimiter
+	closed bool
+}
+
+func (c *closingLimiter) Close() {
+	c.closed = true
+}
+
+func TestKeyedLimiter_ClosesEvictedLimiters(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	var created []*closingLimiter
+	k := NewKeyedLimiter(func() multiLimiterI.RateLimiter {
+		limiter := &closingLimiter{MultiLimiter: NewMultiLimiter(NewLimiter(rate.Every(time.Hour), 1))}
+		created = append(created, limiter)
+		return limiter
+	}, 0, time.Minute, clk)
+
+	k.Get("idle")
+	clk.Advance(30 * time.Second)
+	k.Get("busy")
+	clk.Advance(40 * time.Second)
+	k.Get("busy")
+
+	if !created[0].closed {
+		t.Error("expected the evicted limiter to be closed")
+	}
+	if created[1].closed {
+		t.Error("expected the live limiter not to be closed")
+	}
+}
@@ -3,34 +3,283 @@ package multiLimiter
 import (
 	"code/chapter5/21-tieredMultiLimiter/multiLimiterI"
 	"context"
+	"errors"
+	"fmt"
 	"golang.org/x/time/rate"
+	"math"
 	"sort"
+	"time"
 )
 
+// ErrExceedsBurst 请求消耗的令牌数超过了某个限速器的桶深 这样的请求永远无法被满足
+var ErrExceedsBurst = errors.New("multiLimiter: cost exceeds limiter burst")
+
 type MultiLimiter struct {
 	limiters []multiLimiterI.RateLimiter
+	gate     *Gate
+}
+
+// Cost 一次请求在某个限速器上需要消耗的令牌数
+type Cost struct {
+	Limiter multiLimiterI.RateLimiter
+	N       int
 }
 
+// Wait 等待直到所有限速器都允许执行 或ctx被取消
+// 令牌是从所有限速器中一次性取走的 不会出现只消耗了部分限速器令牌的情况
 func (m *MultiLimiter) Wait(ctx context.Context) error {
-	for _, limiter := range m.limiters {
-		if err := limiter.Wait(ctx); err != nil {
-			return err
-		}
+	return m.WaitN(ctx, 1)
+}
+
+// WaitN 与Wait相同 但从每个限速器中各取走n个令牌
+// 多个调用方同时等待时 按ctx携带的优先级获得令牌 ctx未携带优先级时为PriorityBatch
+func (m *MultiLimiter) WaitN(ctx context.Context, n int) error {
+	priority, ok := PriorityFrom(ctx)
+	if !ok {
+		priority = PriorityBatch
 	}
 
-	return nil
+	return m.WaitNPriority(ctx, n, priority)
+}
+
+// WaitNPriority 与WaitN相同 但使用显式指定的优先级
+func (m *MultiLimiter) WaitNPriority(ctx context.Context, n int, priority int) error {
+	return m.gate.WaitAll(ctx, priority, m.costs(n)...)
 }
 
 func (m *MultiLimiter) Limit() rate.Limit {
 	return m.limiters[0].Limit()
 }
 
+// Burst 所有限速器中最小的桶深
+func (m *MultiLimiter) Burst() int {
+	burst := m.limiters[0].Burst()
+	for _, limiter := range m.limiters[1:] {
+		if b := limiter.Burst(); b < burst {
+			burst = b
+		}
+	}
+
+	return burst
+}
+
+// Tokens 所有能够报告令牌数的限速器中 当前可用令牌数最少的那个的令牌数
+// 没有任何限速器能够报告令牌数时返回rate.Inf
+func (m *MultiLimiter) Tokens() float64 {
+	tokens := float64(rate.Inf)
+	for _, limiter := range m.limiters {
+		if t, ok := limiter.(interface{ Tokens() float64 }); ok {
+			tokens = math.Min(tokens, t.Tokens())
+		}
+	}
+
+	return tokens
+}
+
+// Allow 只有当所有限速器此刻都有可用的令牌时 才从每个限速器中各取走1个令牌并返回true
+// 否则归还已经预留的令牌并返回false
+func (m *MultiLimiter) Allow() bool {
+	return m.AllowN(time.Now(), 1)
+}
+
+// AllowN 与Allow相同 但从每个限速器中各取走n个令牌
+func (m *MultiLimiter) AllowN(t time.Time, n int) bool {
+	reservation := m.ReserveN(t, n)
+	if !reservation.OK() || reservation.DelayFrom(t) > 0 {
+		reservation.CancelAt(t)
+		return false
+	}
+
+	observeWait(reservation, 0, nil)
+	return true
+}
+
+// Reserve 从所有限速器中各预留1个令牌 任意一个限速器预留失败时 取消已经完成的预留
+func (m *MultiLimiter) Reserve() multiLimiterI.Reservation {
+	return m.ReserveN(time.Now(), 1)
+}
+
+// ReserveN 与Reserve相同 但从每个限速器中各预留n个令牌
+func (m *MultiLimiter) ReserveN(t time.Time, n int) multiLimiterI.Reservation {
+	reservation, err := reserveAll(t, m.costs(n))
+	if err != nil {
+		return failedReservation{}
+	}
+
+	return reservation
+}
+
+func (m *MultiLimiter) costs(n int) []Cost {
+	costs := make([]Cost, len(m.limiters))
+	for i, limiter := range m.limiters {
+		costs[i] = Cost{Limiter: limiter, N: n}
+	}
+
+	return costs
+}
+
 func NewMultiLimiter(limiters ...multiLimiterI.RateLimiter) *MultiLimiter {
+	return NewMultiLimiterWithGate(NewGate(DefaultAging), limiters...)
+}
+
+// NewMultiLimiterWithGate 与NewMultiLimiter相同 但等待者在gate中排队
+// 多个MultiLimiter共用同一个gate时 使用相同限速器的等待者之间仍按优先级排队 例如配置更新后重建的MultiLimiter
+func NewMultiLimiterWithGate(gate *Gate, limiters ...multiLimiterI.RateLimiter) *MultiLimiter {
 	byLimit := func(i, j int) bool {
 		// 按限流器限制的速度从低到高排序
 		return limiters[i].Limit() < limiters[j].Limit()
 	}
 
 	sort.Slice(limiters, byLimit)
-	return &MultiLimiter{limiters: limiters}
+	return &MultiLimiter{limiters: limiters, gate: gate}
+}
+
+// WaitAll 等待直到每个限速器都允许取走各自的令牌数 或ctx被取消
+// 与MultiLimiter.Wait相同 令牌是一次性预留的 失败时所有预留都会被归还
+// 用于同一个请求在不同的限速器上消耗不同令牌数的场景 例如每次读文件消耗1个API令牌和与文件大小相当的磁盘令牌
+// 等待结束时 实现了multiLimiterI.WaitObserver的预留会收到等待的时长和结果
+func WaitAll(ctx context.Context, costs ...Cost) error {
+	start := time.Now()
+	reservation, err := reserveAll(start, costs)
+	if err != nil {
+		return err
+	}
+
+	delay := reservation.DelayFrom(start)
+	if delay == 0 {
+		reservation.ObserveWait(0, nil)
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && deadline.Sub(start) < delay {
+		err := deadlineError(delay)
+		reservation.ObserveWait(0, err)
+		reservation.CancelAt(start)
+		return err
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		reservation.ObserveWait(time.Since(start), nil)
+		return nil
+	case <-ctx.Done():
+		reservation.ObserveWait(time.Since(start), ctx.Err())
+		reservation.Cancel()
+		return ctx.Err()
+	}
+}
+
+// deadlineError 需要等待的时长超过ctx的截止时间时返回的错误 包装context.DeadlineExceeded
+func deadlineError(delay time.Duration) error {
+	return fmt.Errorf("multiLimiter: wait %v would exceed context deadline: %w", delay, context.DeadlineExceeded)
+}
+
+// observeWait reservation实现了multiLimiterI.WaitObserver时 报告等待的时长和结果
+func observeWait(reservation multiLimiterI.Reservation, wait time.Duration, err error) {
+	if observer, ok := reservation.(multiLimiterI.WaitObserver); ok {
+		observer.ObserveWait(wait, err)
+	}
+}
+
+// reserveAll 在t时刻从每个限速器中预留各自的令牌数 任意一个限速器预留失败时 取消已经完成的预留
+func reserveAll(t time.Time, costs []Cost) (*multiReservation, error) {
+	// 先检查桶深 避免预留注定失败的令牌
+	for _, cost := range costs {
+		if burst := cost.Limiter.Burst(); cost.N > burst && cost.Limiter.Limit() != rate.Inf {
+			return nil, fmt.Errorf("%w: cost %d, burst %d", ErrExceedsBurst, cost.N, burst)
+		}
+	}
+
+	reservations := make([]multiLimiterI.Reservation, 0, len(costs))
+	for _, cost := range costs {
+		reservation := cost.Limiter.ReserveN(t, cost.N)
+		if !reservation.OK() {
+			// 所有预留都是在t时刻完成的 以t为当前时刻取消预留才能归还全部令牌
+			for _, reserved := range reservations {
+				reserved.CancelAt(t)
+			}
+			return nil, fmt.Errorf("multiLimiter: cannot reserve %d tokens", cost.N)
+		}
+
+		reservations = append(reservations, reservation)
+	}
+
+	return &multiReservation{reservations: reservations}, nil
+}
+
+// multiReservation 由多个限速器的预留组合而成的预留 需要等待的时长为其中最长的等待时长
+type multiReservation struct {
+	reservations []multiLimiterI.Reservation
+}
+
+func (r *multiReservation) OK() bool {
+	return true
+}
+
+func (r *multiReservation) Delay() time.Duration {
+	return r.DelayFrom(time.Now())
 }
+
+func (r *multiReservation) DelayFrom(t time.Time) time.Duration {
+	var delay time.Duration
+	for _, reservation := range r.reservations {
+		if d := reservation.DelayFrom(t); d > delay {
+			delay = d
+		}
+	}
+
+	return delay
+}
+
+// Cancel 以当前时刻归还所有限速器的令牌
+// 不能以预留时的时刻取消: rate.Limiter在归还令牌时会把自己的时钟设为取消的时刻 时钟回退后同一段时间会被重复计入令牌
+// 代价是已经到了执行时刻的限速器(通常是较快的限速器)的令牌不再归还 限速器只会更保守 不会放行过多的请求
+func (r *multiReservation) Cancel() {
+	r.CancelAt(time.Now())
+}
+
+func (r *multiReservation) CancelAt(t time.Time) {
+	for _, reservation := range r.reservations {
+		reservation.CancelAt(t)
+	}
+}
+
+// Release 以t为当前时刻归还所有限速器的令牌 实现了multiLimiterI.Releaser的预留不会将其视为失败
+func (r *multiReservation) Release(t time.Time) {
+	for _, reservation := range r.reservations {
+		if releaser, ok := reservation.(multiLimiterI.Releaser); ok {
+			releaser.Release(t)
+			continue
+		}
+		reservation.CancelAt(t)
+	}
+}
+
+// ObserveWait 将等待的时长和结果报告给每个限速器的预留
+func (r *multiReservation) ObserveWait(wait time.Duration, err error) {
+	for _, reservation := range r.reservations {
+		observeWait(reservation, wait, err)
+	}
+}
+
+// failedReservation 预留失败时返回的预留
+type failedReservation struct{}
+
+func (failedReservation) OK() bool {
+	return false
+}
+
+func (failedReservation) Delay() time.Duration {
+	return rate.InfDuration
+}
+
+func (failedReservation) DelayFrom(time.Time) time.Duration {
+	return rate.InfDuration
+}
+
+func (failedReservation) Cancel() {}
+
+func (failedReservation) CancelAt(time.Time) {}
@@ -0,0 +1,273 @@
+package multiLimiter
+
+import (
+	"code/chapter5/21-tieredMultiLimiter/multiLimiterI"
+	"context"
+	"sync"
+	"time"
+)
+
+// 常用的优先级 数值越大越优先
+const (
+	PriorityBatch       = 0
+	PriorityInteractive = 10
+)
+
+// DefaultAging 等待者每等待DefaultAging 有效优先级提高1
+const DefaultAging = 1 * time.Second
+
+type priorityKey struct{}
+
+// WithPriority 返回携带优先级的ctx 数值越大越优先
+func WithPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// PriorityFrom 返回ctx携带的优先级 ctx未携带优先级时ok为false
+func PriorityFrom(ctx context.Context) (priority int, ok bool) {
+	priority, ok = ctx.Value(priorityKey{}).(int)
+	return priority, ok
+}
+
+// Gate 按优先级决定等待者获得令牌的顺序
+// 只有使用了相同限速器的等待者之间才会互相阻塞 有效优先级较低的等待者不会在有效优先级较高的等待者之前获得令牌
+// 有效优先级为优先级加上等待时长除以aging 因此低优先级的等待者不会被永远饿死 有效优先级相同时先到先得
+// 轮到的等待者只预留一次令牌 并持有该预留直到等待结束 更优先的等待者到来时 持有预留的等待者归还令牌重新排队
+// Cost.Limiter用于判断等待者是否使用了相同的限速器 因此必须是可比较的类型 例如指针
+type Gate struct {
+	aging time.Duration
+
+	mu      sync.Mutex
+	waiters []*waiter
+}
+
+type waiter struct {
+	priority   int
+	enqueuedAt time.Time
+	costs      []Cost
+	// held 已经预留但尚未到执行时刻的令牌 为nil表示未持有预留
+	held *multiReservation
+	// wake 唤醒等待者重新判断是否轮到自己
+	wake chan struct{}
+}
+
+// NewGate aging<=0时有效优先级不随等待时长变化
+func NewGate(aging time.Duration) *Gate {
+	return &Gate{aging: aging}
+}
+
+// WaitAll 与WaitAll函数相同 但按优先级排队 ctx被取消时放弃排队
+func (g *Gate) WaitAll(ctx context.Context, priority int, costs ...Cost) error {
+	start := time.Now()
+	w := &waiter{priority: priority, enqueuedAt: start, costs: costs, wake: make(chan struct{}, 1)}
+
+	g.mu.Lock()
+	g.waiters = append(g.waiters, w)
+	g.mu.Unlock()
+	defer g.leave(w)
+
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	deadline, hasDeadline := ctx.Deadline()
+	for {
+		reservation, delay, preempted, err := g.try(w, deadline, hasDeadline)
+		if err != nil {
+			return err
+		}
+
+		if preempted && timer != nil {
+			timer.Stop()
+			timer = nil
+		}
+		if reservation != nil {
+			if delay == 0 {
+				reservation.ObserveWait(time.Since(start), nil)
+				return nil
+			}
+
+			timer = time.NewTimer(delay)
+		}
+
+		var timeout <-chan time.Time
+		if timer != nil {
+			timeout = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			g.abandon(w, time.Since(start), ctx.Err())
+			return ctx.Err()
+		case <-w.wake:
+		case <-timeout:
+			g.mu.Lock()
+			held := w.held
+			w.held = nil
+			g.mu.Unlock()
+
+			held.ObserveWait(time.Since(start), nil)
+			return nil
+		}
+	}
+}
+
+// try 判断w是否轮到了
+// w持有预留时 若出现了更优先的等待者 则归还令牌并返回preempted 否则继续等待原有的预留 被抢占不是等待的结果 不会报告给预留
+// w未持有预留时 若有更优先的等待者 则唤醒它们(随着等待时长的增加 w可能已经阻塞了它们)
+// 若有持有预留但不如w优先的等待者 则唤醒它们归还令牌 待它们归还后再预留
+// 否则预留令牌 需要等待时由w持有该预留 返回的reservation不为nil表示刚刚完成了预留
+// 需要等待的时长超过deadline时 以预留的时刻立即取消预留 归还全部令牌
+func (g *Gate) try(w *waiter, deadline time.Time, hasDeadline bool) (reservation *multiReservation, delay time.Duration, preempted bool, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	blockers := g.blockersLocked(w, now)
+	if w.held != nil {
+		if len(blockers) == 0 {
+			return nil, 0, false, nil
+		}
+
+		w.held.Release(now)
+		w.held = nil
+		for _, blocker := range blockers {
+			blocker.signal()
+		}
+		return nil, 0, true, nil
+	}
+
+	if len(blockers) > 0 {
+		for _, blocker := range blockers {
+			blocker.signal()
+		}
+		return nil, 0, false, nil
+	}
+
+	if holders := g.holdersLocked(w, now); len(holders) > 0 {
+		for _, holder := range holders {
+			holder.signal()
+		}
+		return nil, 0, false, nil
+	}
+
+	reservation, err = reserveAll(now, w.costs)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	delay = reservation.DelayFrom(now)
+	if delay > 0 && hasDeadline && deadline.Sub(now) < delay {
+		err := deadlineError(delay)
+		reservation.ObserveWait(now.Sub(w.enqueuedAt), err)
+		reservation.CancelAt(now)
+		return nil, 0, false, err
+	}
+	if delay > 0 {
+		w.held = reservation
+	}
+
+	return reservation, delay, false, nil
+}
+
+// abandon 等待失败 报告结果并归还w持有的令牌
+// w还在排队 没有持有预留时 将结果报告给实现了multiLimiterI.WaitObserver的限速器
+func (g *Gate) abandon(w *waiter, wait time.Duration, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if w.held == nil {
+		for _, cost := range w.costs {
+			if observer, ok := cost.Limiter.(multiLimiterI.WaitObserver); ok {
+				observer.ObserveWait(wait, err)
+			}
+		}
+		return
+	}
+
+	w.held.ObserveWait(wait, err)
+	w.held.Cancel()
+	w.held = nil
+}
+
+// holdersLocked 使用了w的某个限速器 持有预留 且不如w优先的等待者
+func (g *Gate) holdersLocked(w *waiter, now time.Time) []*waiter {
+	var holders []*waiter
+	for _, other := range g.waiters {
+		if other != w && other.held != nil && overlaps(w, other) && g.beforeLocked(w, other, now) {
+			holders = append(holders, other)
+		}
+	}
+
+	return holders
+}
+
+// blockersLocked 使用了w的某个限速器 且比w更优先的等待者
+func (g *Gate) blockersLocked(w *waiter, now time.Time) []*waiter {
+	var blockers []*waiter
+	for _, other := range g.waiters {
+		if other != w && overlaps(w, other) && g.beforeLocked(other, w, now) {
+			blockers = append(blockers, other)
+		}
+	}
+
+	return blockers
+}
+
+// beforeLocked a是否比b更优先
+func (g *Gate) beforeLocked(a, b *waiter, now time.Time) bool {
+	pa, pb := g.effectivePriority(a, now), g.effectivePriority(b, now)
+	if pa != pb {
+		return pa > pb
+	}
+
+	return a.enqueuedAt.Before(b.enqueuedAt)
+}
+
+func (g *Gate) effectivePriority(w *waiter, now time.Time) float64 {
+	priority := float64(w.priority)
+	if g.aging > 0 {
+		priority += float64(now.Sub(w.enqueuedAt)) / float64(g.aging)
+	}
+
+	return priority
+}
+
+// leave 移除w 并唤醒其余等待者 它们可能不再被阻塞
+func (g *Gate) leave(w *waiter) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i, other := range g.waiters {
+		if other == w {
+			g.waiters = append(g.waiters[:i], g.waiters[i+1:]...)
+			break
+		}
+	}
+
+	for _, other := range g.waiters {
+		other.signal()
+	}
+}
+
+func (w *waiter) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func overlaps(a, b *waiter) bool {
+	for _, ca := range a.costs {
+		for _, cb := range b.costs {
+			if ca.Limiter == cb.Limiter {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,300 @@
+package multiLimiter
+
+import (
+	"code/chapter5/21-tieredMultiLimiter/multiLimiterI"
+	"context"
+	"golang.org/x/time/rate"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitQueued 等待gate中有n个等待者
+func waitQueued(t *testing.T, g *Gate, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(1 * time.Second)
+	for {
+		g.mu.Lock()
+		queued := len(g.waiters)
+		g.mu.Unlock()
+
+		if queued >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %v waiters, but %v queued", n, queued)
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+func TestMultiLimiter_GrantsByPriority(t *testing.T) {
+	m := NewMultiLimiter(NewLimiter(rate.Every(50*time.Millisecond), 1))
+	m.Allow()
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	start := func(priority int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.Wait(WithPriority(context.Background(), priority)); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, priority)
+			mu.Unlock()
+		}()
+	}
+
+	// 批量请求先到 交互式请求后到
+	for i := 0; i < 3; i++ {
+		start(PriorityBatch)
+		waitQueued(t, m.gate, i+1)
+	}
+	for i := 0; i < 3; i++ {
+		start(PriorityInteractive)
+		waitQueued(t, m.gate, i+4)
+	}
+	wg.Wait()
+
+	expected := []int{
+		PriorityInteractive, PriorityInteractive, PriorityInteractive,
+		PriorityBatch, PriorityBatch, PriorityBatch,
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("expected grant order %v, but received %v", expected, order)
+		}
+	}
+}
+
+func TestGate_AgingPreventsStarvation(t *testing.T) {
+	limiter := NewLimiter(rate.Every(10*time.Millisecond), 1)
+	limiter.Allow()
+	g := NewGate(20 * time.Millisecond)
+
+	lowDone := make(chan time.Time, 1)
+	go func() {
+		g.WaitAll(context.Background(), PriorityBatch, Cost{Limiter: limiter, N: 1})
+		lowDone <- time.Now()
+	}()
+	waitQueued(t, g, 1)
+
+	// 高优先级的请求持续到达 速度超过限速器的速率 没有老化机制时低优先级的请求会被饿死
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var lastHigh time.Time
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.WaitAll(context.Background(), 3, Cost{Limiter: limiter, N: 1})
+			mu.Lock()
+			lastHigh = time.Now()
+			mu.Unlock()
+		}()
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+
+	if low := <-lowDone; !low.Before(lastHigh) {
+		t.Error("expected aged low priority waiter to be served before the high priority backlog drained")
+	}
+}
+
+func TestGate_UnrelatedLimitersDoNotBlock(t *testing.T) {
+	busy := NewLimiter(rate.Every(time.Hour), 1)
+	busy.Allow()
+	idle := NewLimiter(rate.Every(time.Hour), 1)
+	g := NewGate(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go g.WaitAll(ctx, PriorityInteractive, Cost{Limiter: busy, N: 1})
+	waitQueued(t, g, 1)
+
+	done := make(chan error)
+	go func() {
+		done <- g.WaitAll(context.Background(), PriorityBatch, Cost{Limiter: idle, N: 1})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("expected waiter on an idle limiter not to queue behind an unrelated waiter")
+	}
+}
+
+func TestGate_HoldsReservationWhileWaiting(t *testing.T) {
+	limiter := &countingLimiter{Limiter: NewLimiter(rate.Every(30*time.Millisecond), 1)}
+	limiter.Allow()
+	g := NewGate(DefaultAging)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := g.WaitAll(context.Background(), PriorityBatch, Cost{Limiter: limiter, N: 1}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 每个等待者只预留一次 等待期间不会反复预留和取消
+	if reserves, cancels := limiter.counts(); reserves != 3 || cancels != 0 {
+		t.Errorf("expected 3 reservations and no cancellations, but received %v and %v", reserves, cancels)
+	}
+}
+
+func TestGate_PreemptedHolderReturnsTokens(t *testing.T) {
+	limiter := &countingLimiter{Limiter: NewLimiter(rate.Every(50*time.Millisecond), 1)}
+	limiter.Allow()
+	g := NewGate(0)
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	start := func(priority int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := g.WaitAll(context.Background(), priority, Cost{Limiter: limiter, N: 1}); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, priority)
+			mu.Unlock()
+		}()
+	}
+
+	// 批量请求先持有预留 交互式请求到来后抢占
+	start(PriorityBatch)
+	waitQueued(t, g, 1)
+	for limiter.reservesSoFar() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	start(PriorityInteractive)
+	wg.Wait()
+
+	if len(order) != 2 || order[0] != PriorityInteractive {
+		t.Errorf("expected interactive request first, but received %v", order)
+	}
+	if _, cancels := limiter.counts(); cancels != 1 {
+		t.Errorf("expected the preempted reservation to be cancelled once, but received %v", cancels)
+	}
+}
+
+// waitHolder 等待gate中优先级为priority的等待者持有预留
+func waitHolder(t *testing.T, g *Gate, priority int) {
+	t.Helper()
+
+	deadline := time.Now().Add(1 * time.Second)
+	for {
+		g.mu.Lock()
+		held := false
+		for _, w := range g.waiters {
+			if w.priority == priority && w.held != nil {
+				held = true
+			}
+		}
+		g.mu.Unlock()
+
+		if held {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a waiter with priority %v to hold a reservation", priority)
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+func TestGate_PreemptionDoesNotOverAdmit(t *testing.T) {
+	slow := NewLimiter(rate.Every(time.Hour), 1)
+	slow.Allow()
+	shared := NewLimiter(rate.Every(100*time.Millisecond), 100)
+	start := time.Now()
+	shared.AllowN(start, 90)
+	g := NewGate(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	wait := func(priority int, n int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.WaitAll(ctx, priority, Cost{Limiter: slow, N: 1}, Cost{Limiter: shared, N: n})
+		}()
+	}
+
+	// 批量请求持有预留 其在shared上的5个令牌立即到了执行时刻 但slow上的部分要等1小时
+	wait(PriorityBatch, 5)
+	waitHolder(t, g, PriorityBatch)
+	time.Sleep(200 * time.Millisecond)
+
+	// 交互式请求抢占批量请求 批量请求在shared上的部分已经过了执行时刻 取消时不归还 也不能回拨shared的时钟
+	wait(PriorityInteractive, 1)
+	waitHolder(t, g, PriorityInteractive)
+
+	expected := 10 + float64(time.Since(start))/float64(100*time.Millisecond) - 5 - 1
+	if tokens := shared.Tokens(); tokens > expected+0.5 {
+		t.Errorf("expected about %.2f tokens after preemption, but received %.2f", expected, tokens)
+	}
+}
+
+// countingLimiter 记录预留和取消的次数
+type countingLimiter struct {
+	*Limiter
+
+	mu       sync.Mutex
+	reserves int
+	cancels  int
+}
+
+func (l *countingLimiter) ReserveN(t time.Time, n int) multiLimiterI.Reservation {
+	l.mu.Lock()
+	l.reserves++
+	l.mu.Unlock()
+	return &countingReservation{Reservation: l.Limiter.ReserveN(t, n), limiter: l}
+}
+
+func (l *countingLimiter) counts() (reserves, cancels int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.reserves, l.cancels
+}
+
+func (l *countingLimiter) reservesSoFar() int {
+	reserves, _ := l.counts()
+	return reserves
+}
+
+type countingReservation struct {
+	multiLimiterI.Reservation
+	limiter *countingLimiter
+}
+
+func (r *countingReservation) CancelAt(t time.Time) {
+	r.limiter.mu.Lock()
+	r.limiter.cancels++
+	r.limiter.mu.Unlock()
+	r.Reservation.CancelAt(t)
+}
+
+func (r *countingReservation) Cancel() {
+	r.CancelAt(time.Now())
+}
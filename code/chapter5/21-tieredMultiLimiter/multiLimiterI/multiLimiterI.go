@@ -3,9 +3,46 @@ package multiLimiterI
 import (
 	"context"
 	"golang.org/x/time/rate"
+	"time"
 )
 
 type RateLimiter interface {
 	Wait(ctx context.Context) error
+	// WaitN 等待直到可以取走n个令牌 n超过桶深时返回错误
+	WaitN(ctx context.Context, n int) error
 	Limit() rate.Limit
+	// Burst 桶深 即单次请求最多可以消耗的令牌数
+	Burst() int
+	// Allow 若此刻有可用的令牌则取走1个并返回true 否则立即返回false 不会等待
+	Allow() bool
+	// AllowN 若t时刻有n个可用的令牌则取走并返回true 否则立即返回false 不会等待
+	AllowN(t time.Time, n int) bool
+	// Reserve 预留1个令牌 调用者需要等待Reservation.Delay()后才能执行操作 放弃执行时需调用Reservation.Cancel()归还令牌
+	Reserve() Reservation
+	// ReserveN 在t时刻预留n个令牌
+	ReserveN(t time.Time, n int) Reservation
+}
+
+// Reservation 对*rate.Reservation的抽象 使得多个限速器的预留可以组合为一个预留
+type Reservation interface {
+	// OK 是否预留成功 请求的令牌数超过桶深时预留失败
+	OK() bool
+	Delay() time.Duration
+	DelayFrom(t time.Time) time.Duration
+	Cancel()
+	// CancelAt 以t为当前时刻归还令牌 t晚于可以执行的时刻时 令牌被视为已经使用 不会归还
+	CancelAt(t time.Time)
+}
+
+// WaitObserver 预留可以选择实现的接口 按预留等待的一方(例如multiLimiter.WaitAll)在等待结束时调用ObserveWait
+// wait为等待的时长 err为nil表示预留已被使用 否则为等待失败的原因 预留随后会被取消
+// 限速器也可以实现该接口 multiLimiter.Gate在等待者尚未预留就失败时 以非nil的err调用它
+type WaitObserver interface {
+	ObserveWait(wait time.Duration, err error)
+}
+
+// Releaser 预留可以选择实现的接口 multiLimiter.Gate中持有预留的等待者被更优先的等待者抢占时 以Release代替CancelAt归还令牌
+// 被抢占的等待者随后会重新预留 此时等待尚未结束 预留不应被视为失败
+type Releaser interface {
+	Release(t time.Time)
 }
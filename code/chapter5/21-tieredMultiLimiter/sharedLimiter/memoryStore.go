@@ -0,0 +1,42 @@
+package sharedLimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore 保存在进程内存中的TokenStore 可以在同一进程的多个限速器之间共享 也可以交给Server对外提供服务
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucketState
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucketState)}
+}
+
+func (s *MemoryStore) Reserve(_ context.Context, key string, bucket Bucket, t time.Time, n int) (Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state(key, bucket, t).reserve(bucket, t, n), nil
+}
+
+func (s *MemoryStore) Cancel(_ context.Context, key string, bucket Bucket, grant Grant, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state(key, bucket, t).cancel(bucket, grant, t)
+	return nil
+}
+
+func (s *MemoryStore) state(key string, bucket Bucket, t time.Time) *bucketState {
+	state, ok := s.buckets[key]
+	if !ok {
+		state = newBucketState(bucket, t)
+		s.buckets[key] = state
+	}
+
+	return state
+}
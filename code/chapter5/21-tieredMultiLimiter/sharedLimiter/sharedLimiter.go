@@ -0,0 +1,149 @@
+package sharedLimiter
+
+import (
+	"code/chapter5/21-tieredMultiLimiter/multiLimiterI"
+	"context"
+	"fmt"
+	"golang.org/x/time/rate"
+	"time"
+)
+
+// Limiter 令牌桶状态保存在TokenStore中的限速器 满足multiLimiterI.RateLimiter接口 可以交给multiLimiter.NewMultiLimiter组合
+// 使用同一个store和key的所有Limiter 无论在哪个进程中 共享同一份配额
+type Limiter struct {
+	store  TokenStore
+	key    string
+	bucket Bucket
+}
+
+var _ multiLimiterI.RateLimiter = (*Limiter)(nil)
+
+func NewLimiter(store TokenStore, key string, r rate.Limit, b int) *Limiter {
+	return &Limiter{store: store, key: key, bucket: Bucket{Limit: r, Burst: b}}
+}
+
+func (l *Limiter) Limit() rate.Limit {
+	return l.bucket.Limit
+}
+
+func (l *Limiter) Burst() int {
+	return l.bucket.Burst
+}
+
+func (l *Limiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN 等待直到可以取走n个令牌 或ctx被取消 ctx被取消时令牌会归还给store
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if n > l.bucket.Burst && l.bucket.Limit != rate.Inf {
+		return fmt.Errorf("sharedLimiter: Wait(n=%d) exceeds limiter's burst %d", n, l.bucket.Burst)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	now := time.Now()
+	grant, err := l.store.Reserve(ctx, l.key, l.bucket, now, n)
+	if err != nil {
+		return err
+	}
+	if !grant.OK {
+		return fmt.Errorf("sharedLimiter: Wait(n=%d) cannot be satisfied", n)
+	}
+
+	r := &reservation{limiter: l, grant: grant}
+	delay := r.DelayFrom(now)
+	if delay == 0 {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(grant.TimeToAct) {
+		r.CancelAt(now)
+		return fmt.Errorf("sharedLimiter: Wait(n=%d) would exceed context deadline", n)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
+
+func (l *Limiter) Allow() bool {
+	return l.AllowN(time.Now(), 1)
+}
+
+// AllowN t时刻有n个可用的令牌时取走并返回true store不可用时返回false
+func (l *Limiter) AllowN(t time.Time, n int) bool {
+	r := l.ReserveN(t, n)
+	if !r.OK() || r.DelayFrom(t) > 0 {
+		r.CancelAt(t)
+		return false
+	}
+
+	return true
+}
+
+func (l *Limiter) Reserve() multiLimiterI.Reservation {
+	return l.ReserveN(time.Now(), 1)
+}
+
+// ReserveN 在t时刻预留n个令牌 store不可用时返回的预留OK()为false
+// ReserveN没有ctx参数 RemoteStore在这种情况下使用自己的默认超时
+func (l *Limiter) ReserveN(t time.Time, n int) multiLimiterI.Reservation {
+	grant, err := l.store.Reserve(context.Background(), l.key, l.bucket, t, n)
+	if err != nil {
+		return &reservation{limiter: l}
+	}
+
+	return &reservation{limiter: l, grant: grant}
+}
+
+type reservation struct {
+	limiter *Limiter
+	grant   Grant
+}
+
+func (r *reservation) OK() bool {
+	return r.grant.OK
+}
+
+func (r *reservation) Delay() time.Duration {
+	return r.DelayFrom(time.Now())
+}
+
+func (r *reservation) DelayFrom(t time.Time) time.Duration {
+	if !r.grant.OK {
+		return rate.InfDuration
+	}
+
+	delay := r.grant.TimeToAct.Sub(t)
+	if delay < 0 {
+		return 0
+	}
+
+	return delay
+}
+
+func (r *reservation) Cancel() {
+	r.CancelAt(time.Now())
+}
+
+// CancelAt 归还令牌 与*rate.Reservation相同 store不可用时令牌不会被归还
+// 等待中的ctx被取消后仍需归还令牌 因此归还不使用调用方的ctx
+func (r *reservation) CancelAt(t time.Time) {
+	if !r.grant.OK {
+		return
+	}
+
+	r.limiter.store.Cancel(context.Background(), r.limiter.key, r.limiter.bucket, r.grant, t)
+}
@@ -0,0 +1,291 @@
+package sharedLimiter
+
+import (
+	"code/chapter5/21-tieredMultiLimiter/multiLimiter"
+	"context"
+	"golang.org/x/time/rate"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startServer 在本地随机端口启动一个Server 并返回连接到它的n个RemoteStore
+func startServer(t *testing.T, n int) []*RemoteStore {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(NewMemoryStore())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	stores := make([]*RemoteStore, n)
+	for i := range stores {
+		store, err := Dial(listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores[i] = store
+	}
+
+	t.Cleanup(func() {
+		for _, store := range stores {
+			store.Close()
+		}
+		server.Close()
+		if err := <-served; err != nil {
+			t.Errorf("expected Serve to return nil after Close, but received %v", err)
+		}
+	})
+
+	return stores
+}
+
+func TestLimiter_ClientsShareOneBudget(t *testing.T) {
+	stores := startServer(t, 4)
+
+	var limiters []*Limiter
+	for _, store := range stores {
+		limiters = append(limiters, NewLimiter(store, "api", rate.Every(time.Hour), 10))
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for _, limiter := range limiters {
+		wg.Add(1)
+		go func(limiter *Limiter) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				if limiter.Allow() {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+			}
+		}(limiter)
+	}
+	wg.Wait()
+
+	if allowed != 10 {
+		t.Errorf("expected 10 allowed across all clients, but received %v", allowed)
+	}
+}
+
+func TestLimiter_KeysAreIndependent(t *testing.T) {
+	stores := startServer(t, 2)
+
+	api := NewLimiter(stores[0], "api", rate.Every(time.Hour), 1)
+	disk := NewLimiter(stores[1], "disk", rate.Every(time.Hour), 1)
+
+	if !api.Allow() || !disk.Allow() {
+		t.Fatal("expected first call on each key to be allowed")
+	}
+	if api.Allow() || disk.Allow() {
+		t.Error("expected second call on each key to be rejected")
+	}
+}
+
+func TestLimiter_CancelReturnsTokensToOtherClients(t *testing.T) {
+	stores := startServer(t, 2)
+
+	first := NewLimiter(stores[0], "api", rate.Every(time.Hour), 1)
+	second := NewLimiter(stores[1], "api", rate.Every(time.Hour), 1)
+
+	now := time.Now()
+	reservation := first.ReserveN(now, 1)
+	if !reservation.OK() || reservation.DelayFrom(now) != 0 {
+		t.Fatal("expected immediate reservation")
+	}
+	if second.AllowN(now, 1) {
+		t.Fatal("expected second client to see the token taken")
+	}
+
+	reservation.CancelAt(now)
+	if !second.AllowN(now, 1) {
+		t.Error("expected cancelled token to be available to second client")
+	}
+}
+
+func TestLimiter_WaitNRejectsCostAboveBurst(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), "disk", rate.Limit(10), 2)
+
+	if err := limiter.WaitN(context.Background(), 3); err == nil {
+		t.Error("expected WaitN above burst to fail")
+	}
+}
+
+func TestLimiter_WaitSpacesEventsAcrossClients(t *testing.T) {
+	stores := startServer(t, 2)
+
+	limiters := []*Limiter{
+		NewLimiter(stores[0], "api", rate.Every(20*time.Millisecond), 1),
+		NewLimiter(stores[1], "api", rate.Every(20*time.Millisecond), 1),
+	}
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := limiters[i%2].Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 第1个事件立即执行 之后每20ms执行1个
+	if elapsed := time.Since(start); elapsed < 55*time.Millisecond {
+		t.Errorf("expected 4 waits to take at least 60ms, but took %v", elapsed)
+	}
+}
+
+func TestLimiter_FitsMultiLimiter(t *testing.T) {
+	stores := startServer(t, 2)
+
+	// 每个进程有自己的本地限速器 同时共享同一个全局限速器
+	replicas := []*multiLimiter.MultiLimiter{
+		multiLimiter.NewMultiLimiter(
+			multiLimiter.NewLimiter(rate.Limit(1000), 5),
+			NewLimiter(stores[0], "global", rate.Every(time.Hour), 6),
+		),
+		multiLimiter.NewMultiLimiter(
+			multiLimiter.NewLimiter(rate.Limit(1000), 5),
+			NewLimiter(stores[1], "global", rate.Every(time.Hour), 6),
+		),
+	}
+
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if replicas[i%2].Allow() {
+			allowed++
+		}
+	}
+
+	if allowed != 6 {
+		t.Errorf("expected the shared budget of 6 to cap both replicas, but received %v", allowed)
+	}
+}
+
+func TestMemoryStore_ReserveMatchesRateLimiter(t *testing.T) {
+	store := NewMemoryStore()
+	bucket := Bucket{Limit: rate.Limit(2), Burst: 3}
+	reference := rate.NewLimiter(bucket.Limit, bucket.Burst)
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		now := start.Add(time.Duration(i) * 100 * time.Millisecond)
+		n := i%3 + 1
+
+		grant, err := store.Reserve(context.Background(), "key", bucket, now, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := reference.ReserveN(now, n)
+
+		if grant.OK != expected.OK() {
+			t.Fatalf("reservation %v: expected ok %v, but received %v", i, expected.OK(), grant.OK)
+		}
+		if delay := grant.TimeToAct.Sub(now); delay != expected.DelayFrom(now) {
+			t.Errorf("reservation %v: expected delay %v, but received %v", i, expected.DelayFrom(now), delay)
+		}
+	}
+}
+
+// flakyServer 接受连接 第一个连接只读取请求而从不响应 之后的连接交给server正常处理
+func flakyServer(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(NewMemoryStore())
+
+	var wg sync.WaitGroup
+	go func() {
+		first := true
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if !first {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer conn.Close()
+					server.serveConn(conn)
+				}()
+				continue
+			}
+
+			first = false
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer conn.Close()
+				// 模拟卡住的存储 只读取不响应
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	t.Cleanup(func() {
+		listener.Close()
+		wg.Wait()
+	})
+	return listener.Addr().String()
+}
+
+func TestRemoteStore_StalledServerRespectsContextAndRedials(t *testing.T) {
+	store, err := Dial(flakyServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	limiter := NewLimiter(store, "api", rate.Every(time.Hour), 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := limiter.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, but received %v", context.DeadlineExceeded, err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("expected Wait to give up at the context deadline, but took %v", took)
+	}
+
+	// 卡住的连接被丢弃 下一个请求重新建立连接
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Errorf("expected Wait to succeed on a new connection, but received %v", err)
+	}
+}
+
+func TestRemoteStore_CancelledWhileQueued(t *testing.T) {
+	store, err := Dial(flakyServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// 第一个请求卡在无响应的连接上 第二个请求在排队时ctx被取消
+	first, cancelFirst := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancelFirst()
+	go store.Reserve(first, "api", Bucket{Limit: 1, Burst: 1}, time.Now(), 1)
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := store.Reserve(ctx, "api", Bucket{Limit: 1, Burst: 1}, time.Now(), 1); err != context.Canceled {
+		t.Errorf("expected %v, but received %v", context.Canceled, err)
+	}
+	if took := time.Since(start); took > 300*time.Millisecond {
+		t.Errorf("expected queued request to give up when cancelled, but took %v", took)
+	}
+}
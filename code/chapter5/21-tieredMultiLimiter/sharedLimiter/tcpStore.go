@@ -0,0 +1,309 @@
+package sharedLimiter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	opReserve = "reserve"
+	opCancel  = "cancel"
+)
+
+// request Server与RemoteStore之间的请求 每个请求和响应都是一行JSON
+type request struct {
+	Op     string    `json:"op"`
+	Key    string    `json:"key"`
+	Bucket Bucket    `json:"bucket"`
+	Time   time.Time `json:"time"`
+	N      int       `json:"n,omitempty"`
+	Grant  Grant     `json:"grant"`
+}
+
+type response struct {
+	Grant Grant  `json:"grant"`
+	Error string `json:"error,omitempty"`
+}
+
+// Server 通过TCP对外提供TokenStore 使得多个进程可以共享同一份配额
+type Server struct {
+	store TokenStore
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+func NewServer(store TokenStore) *Server {
+	return &Server{store: store, conns: make(map[net.Conn]struct{})}
+}
+
+// Serve 在listener上接受连接 直到Close被调用
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		listener.Close()
+		return net.ErrClosed
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return nil
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(conn)
+			s.serveConn(conn)
+		}()
+	}
+}
+
+// Close 关闭listener和所有连接 并等待所有连接处理完毕
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, conn)
+	conn.Close()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	decoder := json.NewDecoder(bufio.NewReader(conn))
+	encoder := json.NewEncoder(conn)
+
+	for {
+		var req request
+		if err := decoder.Decode(&req); err != nil {
+			return
+		}
+
+		var resp response
+		var err error
+		switch req.Op {
+		case opReserve:
+			resp.Grant, err = s.store.Reserve(context.Background(), req.Key, req.Bucket, req.Time, req.N)
+		case opCancel:
+			err = s.store.Cancel(context.Background(), req.Key, req.Bucket, req.Grant, req.Time)
+		default:
+			err = fmt.Errorf("unknown op %q", req.Op)
+		}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+
+		if err := encoder.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// DefaultTimeout ctx没有截止时间时 RemoteStore的每个请求最多等待的时长
+const DefaultTimeout = 5 * time.Second
+
+// RemoteStore 通过TCP访问Server的TokenStore 同一个RemoteStore上的请求是串行的
+// 连接出现读写或解码错误后 连接上的请求与响应可能已经错位 因此会丢弃该连接 下一个请求重新建立连接
+type RemoteStore struct {
+	address string
+	// turn 容量为1 持有者可以使用连接 用channel而非sync.Mutex是为了在排队时也能响应ctx
+	turn chan struct{}
+
+	mu      sync.Mutex
+	closed  bool
+	conn    net.Conn
+	decoder *json.Decoder
+	encoder *json.Encoder
+}
+
+// Dial 连接address上的Server
+func Dial(address string) (*RemoteStore, error) {
+	s := &RemoteStore{address: address, turn: make(chan struct{}, 1)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	if _, err := s.connect(ctx); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *RemoteStore) Reserve(ctx context.Context, key string, bucket Bucket, t time.Time, n int) (Grant, error) {
+	resp, err := s.roundTrip(ctx, request{Op: opReserve, Key: key, Bucket: bucket, Time: t, N: n})
+	return resp.Grant, err
+}
+
+func (s *RemoteStore) Cancel(ctx context.Context, key string, bucket Bucket, grant Grant, t time.Time) error {
+	_, err := s.roundTrip(ctx, request{Op: opCancel, Key: key, Bucket: bucket, Time: t, Grant: grant})
+	return err
+}
+
+// Close 关闭连接 正在进行的请求返回错误 之后的请求返回net.ErrClosed
+func (s *RemoteStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *RemoteStore) roundTrip(ctx context.Context, req request) (response, error) {
+	select {
+	case s.turn <- struct{}{}:
+	case <-ctx.Done():
+		return response{}, ctx.Err()
+	}
+	defer func() { <-s.turn }()
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultTimeout)
+		defer cancel()
+	}
+
+	conn, err := s.connect(ctx)
+	if err != nil {
+		return response{}, err
+	}
+
+	// 以ctx的截止时间作为连接的读写截止时间 ctx被提前取消时立即使读写失败
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	resp, err := s.exchange(req)
+	if err != nil {
+		s.drop(conn)
+		if ctx.Err() != nil {
+			return response{}, ctx.Err()
+		}
+		// 连接的截止时间可能略早于ctx的计时器触发
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return response{}, context.DeadlineExceeded
+		}
+		return response{}, err
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+
+	return resp, nil
+}
+
+func (s *RemoteStore) exchange(req request) (response, error) {
+	s.mu.Lock()
+	encoder, decoder := s.encoder, s.decoder
+	s.mu.Unlock()
+
+	if err := encoder.Encode(req); err != nil {
+		return response{}, err
+	}
+
+	var resp response
+	if err := decoder.Decode(&resp); err != nil {
+		return response{}, err
+	}
+
+	return resp, nil
+}
+
+// connect 返回当前的连接 没有连接时重新建立连接
+func (s *RemoteStore) connect(ctx context.Context) (net.Conn, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, net.ErrClosed
+	}
+	if s.conn != nil {
+		conn := s.conn
+		s.mu.Unlock()
+		return conn, nil
+	}
+	s.mu.Unlock()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		conn.Close()
+		return nil, net.ErrClosed
+	}
+	s.conn = conn
+	s.decoder = json.NewDecoder(bufio.NewReader(conn))
+	s.encoder = json.NewEncoder(conn)
+	return conn, nil
+}
+
+// drop 关闭出错的连接 下一个请求将重新建立连接
+func (s *RemoteStore) drop(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conn.Close()
+	if s.conn == conn {
+		s.conn = nil
+	}
+}
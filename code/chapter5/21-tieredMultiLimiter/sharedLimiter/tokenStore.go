@@ -0,0 +1,138 @@
+package sharedLimiter
+
+import (
+	"context"
+	"golang.org/x/time/rate"
+	"time"
+)
+
+// Bucket 令牌桶的参数 同一个key的所有客户端应使用相同的参数
+type Bucket struct {
+	Limit rate.Limit
+	Burst int
+}
+
+// Grant 一次预留的结果
+type Grant struct {
+	// OK 是否预留成功 请求的令牌数超过桶深时预留失败
+	OK bool
+	// Tokens 预留的令牌数
+	Tokens int
+	// TimeToAct 可以执行操作的时刻
+	TimeToAct time.Time
+}
+
+// TokenStore 保存令牌桶状态的存储 多个进程中的限速器通过共享同一个存储来共享同一份配额
+// 实现必须保证对同一个key的Reserve和Cancel是原子的
+// 时刻t由调用方给出 因此共享同一个存储的进程需要使用一致的时钟
+// 远程的实现应在ctx被取消或超过截止时间时放弃请求并返回错误 不能因存储无响应而一直阻塞调用方
+type TokenStore interface {
+	// Reserve 在t时刻从key对应的桶中预留n个令牌
+	Reserve(ctx context.Context, key string, bucket Bucket, t time.Time, n int) (Grant, error)
+	// Cancel 以t为当前时刻归还grant预留的令牌 语义与rate.Reservation.CancelAt相同
+	Cancel(ctx context.Context, key string, bucket Bucket, grant Grant, t time.Time) error
+}
+
+// bucketState 令牌桶的状态 算法与rate.Limiter相同
+type bucketState struct {
+	tokens float64
+	// last 最后一次更新tokens的时刻
+	last time.Time
+	// lastEvent 最近一次预留的执行时刻
+	lastEvent time.Time
+}
+
+func newBucketState(bucket Bucket, t time.Time) *bucketState {
+	return &bucketState{tokens: float64(bucket.Burst), last: t}
+}
+
+func (s *bucketState) reserve(bucket Bucket, t time.Time, n int) Grant {
+	if bucket.Limit == rate.Inf {
+		return Grant{OK: true, Tokens: n, TimeToAct: t}
+	}
+
+	if bucket.Limit == 0 {
+		// 令牌不会再生 只能消耗桶中剩余的令牌
+		if s.tokens < float64(n) {
+			return Grant{OK: false}
+		}
+		s.tokens -= float64(n)
+		return Grant{OK: true, Tokens: n, TimeToAct: t}
+	}
+
+	t, tokens := s.advance(bucket, t)
+	tokens -= float64(n)
+
+	var wait time.Duration
+	if tokens < 0 {
+		wait = durationFromTokens(bucket.Limit, -tokens)
+	}
+
+	if n > bucket.Burst {
+		return Grant{OK: false}
+	}
+
+	grant := Grant{OK: true, Tokens: n, TimeToAct: t.Add(wait)}
+	s.last = t
+	s.tokens = tokens
+	s.lastEvent = grant.TimeToAct
+	return grant
+}
+
+func (s *bucketState) cancel(bucket Bucket, grant Grant, t time.Time) {
+	if !grant.OK || bucket.Limit == rate.Inf || grant.Tokens == 0 || grant.TimeToAct.Before(t) {
+		return
+	}
+
+	// grant之后完成的预留所消耗的令牌不能归还
+	restoreTokens := float64(grant.Tokens) - tokensFromDuration(bucket.Limit, s.lastEvent.Sub(grant.TimeToAct))
+	if restoreTokens <= 0 {
+		return
+	}
+
+	t, tokens := s.advance(bucket, t)
+	tokens += restoreTokens
+	if burst := float64(bucket.Burst); tokens > burst {
+		tokens = burst
+	}
+
+	s.last = t
+	s.tokens = tokens
+	if grant.TimeToAct.Equal(s.lastEvent) {
+		prevEvent := grant.TimeToAct.Add(durationFromTokens(bucket.Limit, float64(-grant.Tokens)))
+		if !prevEvent.Before(t) {
+			s.lastEvent = prevEvent
+		}
+	}
+}
+
+// advance 计算t时刻桶中的令牌数 不修改状态
+func (s *bucketState) advance(bucket Bucket, t time.Time) (time.Time, float64) {
+	last := s.last
+	if t.Before(last) {
+		last = t
+	}
+
+	tokens := s.tokens + tokensFromDuration(bucket.Limit, t.Sub(last))
+	if burst := float64(bucket.Burst); tokens > burst {
+		tokens = burst
+	}
+
+	return t, tokens
+}
+
+func durationFromTokens(limit rate.Limit, tokens float64) time.Duration {
+	if limit <= 0 {
+		return rate.InfDuration
+	}
+
+	return time.Duration(float64(time.Second) * tokens / float64(limit))
+}
+
+func tokensFromDuration(limit rate.Limit, d time.Duration) float64 {
+	if limit <= 0 {
+		return 0
+	}
+
+	return d.Seconds() * float64(limit)
+}
@@ -2,48 +2,114 @@ package main
 
 import (
 	"code/chapter5/21-tieredMultiLimiter/client"
+	"code/chapter5/21-tieredMultiLimiter/limitConfig"
+	"code/chapter5/21-tieredMultiLimiter/limiterMetrics"
 	"context"
+	"flag"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"sync"
+	"time"
 )
 
+// open 指定了-config时从配置文件创建APIConnection 并在运行期间每秒检查一次配置文件 修改配置文件即可调整限速
+// 指定了-metrics时 在该地址的/metrics上以Prometheus文本格式导出每个层级的指标
+func open() (*client.APIConnection, *limiterMetrics.Registry) {
+	path := flag.String("config", "", "path of the JSON limit config, e.g. limits.json")
+	metricsAddress := flag.String("metrics", "", "address to serve /metrics on, e.g. 127.0.0.1:9090")
+	flag.Parse()
+
+	var registry *limiterMetrics.Registry
+	if *metricsAddress != "" {
+		registry = limiterMetrics.NewRegistry(nil)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", registry)
+		go func() {
+			log.Printf("cannot serve metrics: %v\n", http.ListenAndServe(*metricsAddress, mux))
+		}()
+	}
+
+	config := client.DefaultConfig()
+	if *path != "" {
+		var err error
+		if config, err = limitConfig.Load(*path); err != nil {
+			log.Fatalf("cannot load config: %v\n", err)
+		}
+	}
+
+	tiers, err := limitConfig.NewTiers(config)
+	if err != nil {
+		log.Fatalf("cannot build tiers: %v\n", err)
+	}
+
+	apiConnection, err := client.OpenTiers(tiers, registry)
+	if err != nil {
+		log.Fatalf("cannot open connection: %v\n", err)
+	}
+
+	if *path == "" {
+		return apiConnection, registry
+	}
+
+	// 程序退出前一直监视配置文件
+	errs := limitConfig.Watch(make(chan interface{}), *path, tiers, 1*time.Second, nil)
+	go func() {
+		for err := range errs {
+			log.Printf("cannot reload config: %v\n", err)
+		}
+	}()
+
+	return apiConnection, registry
+}
+
 func main() {
 	defer log.Printf("Done.\n")
 
 	log.SetOutput(os.Stdout)
 	log.SetFlags(log.Ltime | log.LUTC)
 
-	apiConnection := client.Open()
+	apiConnection, registry := open()
 
 	var wg sync.WaitGroup
 	wg.Add(20)
 
 	for i := 0; i < 10; i++ {
+		// 两个租户的请求分别限速 互不影响
+		tenantID := fmt.Sprintf("tenant-%d", i%2)
+		// 读取的文件越大 消耗的磁盘令牌越多
+		cost := i%4 + 1
 		go func() {
 			defer wg.Done()
 
-			err := apiConnection.ReadFile(context.Background())
+			err := apiConnection.ReadFile(context.Background(), tenantID, cost)
 			if err != nil {
 				log.Printf("cannot read file: %v\n", err)
 			}
 
-			log.Printf("ReadFile\n")
+			log.Printf("%v ReadFile\n", tenantID)
 		}()
 	}
 
 	for i := 0; i < 10; i++ {
+		tenantID := fmt.Sprintf("tenant-%d", i%2)
 		go func() {
 			defer wg.Done()
 
-			err := apiConnection.ResolveAddress(context.Background())
+			err := apiConnection.ResolveAddress(context.Background(), tenantID, 1)
 			if err != nil {
 				log.Printf("cannot resolve address: %v\n", err)
 			}
 
-			log.Printf("ResolveAddress\n")
+			log.Printf("%v ResolveAddress\n", tenantID)
 		}()
 	}
 
 	wg.Wait()
+
+	// 各层级的reserve_delay越大 说明该层级越是瓶颈
+	if registry != nil {
+		registry.WriteTo(os.Stdout)
+	}
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"code/chapter5/21-tieredMultiLimiter/sharedLimiter"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+)
+
+// 共享令牌存储进程 同一台机器上的多个服务进程通过sharedLimiter.Dial连接到此进程 共享同一份配额
+func main() {
+	address := flag.String("addr", "127.0.0.1:7070", "listen address")
+	flag.Parse()
+
+	listener, err := net.Listen("tcp", *address)
+	if err != nil {
+		log.Fatalf("cannot listen on %v: %v\n", *address, err)
+	}
+
+	server := sharedLimiter.NewServer(sharedLimiter.NewMemoryStore())
+
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+		server.Close()
+	}()
+
+	log.Printf("token store listening on %v\n", listener.Addr())
+	if err := server.Serve(listener); err != nil {
+		log.Fatalf("serve: %v\n", err)
+	}
+}
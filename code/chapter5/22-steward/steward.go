@@ -1,6 +1,7 @@
 package main
 
 import (
+	"code/clock"
 	"log"
 	"time"
 )
@@ -11,7 +12,7 @@ func main() {
 
 }
 
-func newSteward(timeout time.Duration, startGoroutine startGoroutineFn) startGoroutineFn {
+func newSteward(clk clock.Clock, timeout time.Duration, startGoroutine startGoroutineFn) startGoroutineFn {
 	return func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
 		heartbeat := make(chan interface{})
 
@@ -24,11 +25,11 @@ func newSteward(timeout time.Duration, startGoroutine startGoroutineFn) startGor
 				wardHeartbeat = startGoroutine(or(wardDone, done), timeout/2)
 			}
 			startWard()
-			pulse := time.Tick(pulseInterval)
+			pulse := clk.Tick(pulseInterval)
 
 		monitorLoop:
 			for {
-				timeSignal := time.After(timeout)
+				timeSignal := clk.After(timeout)
 
 				for {
 					select {
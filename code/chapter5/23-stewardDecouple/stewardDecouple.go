@@ -1,6 +1,7 @@
 package main
 
 import (
+	"code/clock"
 	"log"
 	"time"
 )
@@ -14,7 +15,7 @@ func main() {
 // steward 返回一个函数 该函数启动并监控goroutine 若该goroutine停止工作 则该函数重新启动一个goroutine并监控该goroutine
 // timeout 被监控的goroutine的超时时间
 // startGoroutine 启动被监控的goroutine的函数
-func steward(timeout time.Duration, startGoroutine startGoroutineFn) startGoroutineFn {
+func steward(clk clock.Clock, timeout time.Duration, startGoroutine startGoroutineFn) startGoroutineFn {
 	return func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
 		heartbeat := make(chan interface{})
 
@@ -22,11 +23,11 @@ func steward(timeout time.Duration, startGoroutine startGoroutineFn) startGorout
 			defer close(heartbeat)
 
 			wardDone, wardHeartbeat := startWard(done, startGoroutine, timeout)
-			pulse := time.Tick(pulseInterval)
+			pulse := clk.Tick(pulseInterval)
 
 		monitorLoop:
 			for {
-				timeoutSignal := time.After(timeout)
+				timeoutSignal := clk.After(timeout)
 				for {
 					select {
 					case <-pulse:
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"code/clock"
 	"log"
 	"os"
 	"time"
@@ -12,7 +13,7 @@ func main() {
 	log.SetOutput(os.Stdout)
 	log.SetFlags(log.Ltime | log.LUTC)
 
-	doWorkSteward := steward(4*time.Second, doWork)
+	doWorkSteward := steward(clock.Real{}, 4*time.Second, doWork)
 
 	done := make(chan interface{})
 	time.AfterFunc(9*time.Second, func() {
@@ -34,7 +35,7 @@ func doWork(done <-chan interface{}, _ time.Duration) <-chan interface{} {
 	return nil
 }
 
-func steward(timeout time.Duration, startGoroutine startGoroutineFn) startGoroutineFn {
+func steward(clk clock.Clock, timeout time.Duration, startGoroutine startGoroutineFn) startGoroutineFn {
 	return func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
 		heartbeat := make(chan interface{})
 
@@ -42,11 +43,11 @@ func steward(timeout time.Duration, startGoroutine startGoroutineFn) startGorout
 			defer close(heartbeat)
 
 			wardDone, wardHeartbeat := startWard(done, startGoroutine, timeout)
-			pulse := time.Tick(pulseInterval)
+			pulse := clk.Tick(pulseInterval)
 
 		monitorLoop:
 			for {
-				timeoutSignal := time.After(timeout)
+				timeoutSignal := clk.After(timeout)
 				for {
 					select {
 					case <-pulse:
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"code/clock"
 	"log"
 	"time"
 )
@@ -10,7 +11,7 @@ type startGoroutineFn func(done <-chan interface{}, pulseInterval time.Duration)
 func main() {
 }
 
-func doWorkFn(done <-chan interface{}, intList ...int) (startGoroutineFn, <-chan interface{}) {
+func doWorkFn(done <-chan interface{}, clk clock.Clock, intList ...int) (startGoroutineFn, <-chan interface{}) {
 	intChanStream := make(chan (<-chan interface{}))
 	resultIntStream := bridge(done, intChanStream)
 
@@ -26,7 +27,7 @@ func doWorkFn(done <-chan interface{}, intList ...int) (startGoroutineFn, <-chan
 				return
 			}
 
-			pulse := time.Tick(pulseInterval)
+			pulse := clk.Tick(pulseInterval)
 
 			for {
 			valueLoop:
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"code/clock"
 	"log"
 	"os"
 	"time"
@@ -12,11 +13,12 @@ func main() {
 	log.SetOutput(os.Stdout)
 	log.SetFlags(log.Ltime | log.LUTC)
 
+	clk := clock.Real{}
 	done := make(chan interface{})
 	defer close(done)
 
-	doWork, resultIntStream := doWorkFn(done, 1, 2, -1, 3, 4, 5)
-	doWorkWithSteward := steward(1*time.Second, doWork)
+	doWork, resultIntStream := doWorkFn(done, clk, 1, 2, -1, 3, 4, 5)
+	doWorkWithSteward := steward(clk, 1*time.Second, doWork)
 	doWorkWithSteward(done, 1*time.Hour)
 
 	for intVal := range take(done, resultIntStream, 6) {
@@ -24,7 +26,7 @@ func main() {
 	}
 }
 
-func doWorkFn(done <-chan interface{}, intList ...int) (startGoroutineFn, <-chan interface{}) {
+func doWorkFn(done <-chan interface{}, clk clock.Clock, intList ...int) (startGoroutineFn, <-chan interface{}) {
 	intChanStream := make(chan (<-chan interface{}))
 	resultIntStream := bridge(done, intChanStream)
 
@@ -40,7 +42,7 @@ func doWorkFn(done <-chan interface{}, intList ...int) (startGoroutineFn, <-chan
 				return
 			}
 
-			pulse := time.Tick(pulseInterval)
+			pulse := clk.Tick(pulseInterval)
 
 			for {
 			valueLoop:
@@ -141,7 +143,7 @@ func sendPulse(heartbeat chan interface{}) {
 	}
 }
 
-func steward(timeout time.Duration, startGoroutine startGoroutineFn) startGoroutineFn {
+func steward(clk clock.Clock, timeout time.Duration, startGoroutine startGoroutineFn) startGoroutineFn {
 	return func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
 		heartbeat := make(chan interface{})
 
@@ -149,13 +151,13 @@ func steward(timeout time.Duration, startGoroutine startGoroutineFn) startGorout
 			defer close(heartbeat)
 
 			wardDone, wardHeartbeat := startWard(done, startGoroutine, timeout)
-			pulse := time.Tick(pulseInterval)
+			pulse := clk.Tick(pulseInterval)
 
 			failedCounter := 0
 
 		monitorLoop:
 			for {
-				timeoutSignal := time.After(timeout)
+				timeoutSignal := clk.After(timeout)
 				for {
 					select {
 					case <-pulse:
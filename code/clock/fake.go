@@ -0,0 +1,201 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake 一个只有在调用Advance时才会前进的Clock
+// 通过Fake创建的定时器在Advance跨过其到期时刻时触发 触发的顺序与到期时刻的顺序一致
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+	changed chan struct{} // 每次waiters发生变化时关闭并重建 用于实现BlockUntil
+}
+
+// fakeWaiter 一个尚未到期的定时器 period大于0时表示这是一个Ticker
+type fakeWaiter struct {
+	clock    *Fake
+	deadline time.Time
+	period   time.Duration
+	c        chan time.Time
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now, changed: make(chan struct{})}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// Tick 与time.Tick相同 返回的Ticker无法停止 d<=0时返回nil
+func (f *Fake) Tick(d time.Duration) <-chan time.Time {
+	if d <= 0 {
+		return nil
+	}
+	return f.NewTicker(d).C()
+}
+
+// Sleep 阻塞直到其他goroutine调用Advance使时间越过d
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	w := &fakeWaiter{clock: f, c: make(chan time.Time, 1)}
+	w.Reset(d)
+	return w
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+
+	w := &fakeWaiter{clock: f, c: make(chan time.Time, 1)}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.period = d
+	f.addLocked(w, f.now.Add(d))
+	return fakeTicker{w}
+}
+
+// Advance 将时间向前推进d 并按到期时刻的顺序触发期间到期的所有定时器
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	end := f.now.Add(d)
+	for len(f.waiters) > 0 && !f.waiters[0].deadline.After(end) {
+		w := f.waiters[0]
+		f.removeLocked(w)
+		f.now = w.deadline
+
+		select {
+		case w.c <- f.now:
+		default:
+		}
+
+		if w.period > 0 {
+			f.addLocked(w, w.deadline.Add(w.period))
+		}
+	}
+	f.now = end
+}
+
+// Waiters 返回当前尚未到期的定时器数量
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil 阻塞直到尚未到期的定时器数量恰好为n
+// 测试中用于等待被测goroutine创建好定时器后再调用Advance
+func (f *Fake) BlockUntil(n int) {
+	for {
+		f.mu.Lock()
+		count, changed := len(f.waiters), f.changed
+		f.mu.Unlock()
+
+		if count == n {
+			return
+		}
+		<-changed
+	}
+}
+
+func (f *Fake) addLocked(w *fakeWaiter, deadline time.Time) {
+	w.deadline = deadline
+	i := sort.Search(len(f.waiters), func(i int) bool {
+		return f.waiters[i].deadline.After(deadline)
+	})
+	f.waiters = append(f.waiters, nil)
+	copy(f.waiters[i+1:], f.waiters[i:])
+	f.waiters[i] = w
+	f.notifyLocked()
+}
+
+// removeLocked 移除w 若w不在waiters中(已到期或已停止)则返回false
+func (f *Fake) removeLocked(w *fakeWaiter) bool {
+	for i, waiter := range f.waiters {
+		if waiter == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			f.notifyLocked()
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Fake) notifyLocked() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+func (w *fakeWaiter) Stop() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	return w.clock.removeLocked(w)
+}
+
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	f := w.clock
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	active := f.removeLocked(w)
+	if d <= 0 {
+		// 与time.Timer相同 非正数的时长使定时器立即触发
+		select {
+		case w.c <- f.now:
+		default:
+		}
+		return active
+	}
+
+	f.addLocked(w, f.now.Add(d))
+	return active
+}
+
+// fakeTicker 包装fakeWaiter以满足Ticker接口 Ticker的Stop和Reset没有返回值
+type fakeTicker struct {
+	w *fakeWaiter
+}
+
+func (t fakeTicker) C() <-chan time.Time {
+	return t.w.c
+}
+
+func (t fakeTicker) Stop() {
+	t.w.Stop()
+}
+
+func (t fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("clock: non-positive interval for Ticker.Reset")
+	}
+
+	t.w.clock.mu.Lock()
+	defer t.w.clock.mu.Unlock()
+	t.w.clock.removeLocked(t.w)
+	t.w.period = d
+	t.w.clock.addLocked(t.w, t.w.clock.now.Add(d))
+}
@@ -0,0 +1,112 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFake_TimerFiresOnlyAfterAdvance(t *testing.T) {
+	clk := NewFake(epoch)
+	timer := clk.NewTimer(time.Second)
+
+	clk.Advance(999 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired before deadline")
+	default:
+	}
+
+	clk.Advance(time.Millisecond)
+	select {
+	case fired := <-timer.C():
+		if expected := epoch.Add(time.Second); !fired.Equal(expected) {
+			t.Errorf("expected timer to fire at %v, but fired at %v", expected, fired)
+		}
+	default:
+		t.Fatal("timer did not fire at deadline")
+	}
+
+	if clk.Waiters() != 0 {
+		t.Errorf("expected no waiters, but got %v", clk.Waiters())
+	}
+}
+
+func TestFake_StopAndReset(t *testing.T) {
+	clk := NewFake(epoch)
+	timer := clk.NewTimer(time.Second)
+
+	if !timer.Stop() {
+		t.Error("expected Stop to report an active timer")
+	}
+	clk.Advance(time.Hour)
+	select {
+	case <-timer.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+
+	if timer.Reset(time.Second) {
+		t.Error("expected Reset to report an inactive timer")
+	}
+	clk.Advance(time.Second)
+	select {
+	case <-timer.C():
+	default:
+		t.Fatal("reset timer did not fire")
+	}
+}
+
+func TestFake_TickerFiresEveryPeriod(t *testing.T) {
+	clk := NewFake(epoch)
+	ticker := clk.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for i := 1; i <= 3; i++ {
+		clk.Advance(time.Second)
+		select {
+		case tick := <-ticker.C():
+			if expected := epoch.Add(time.Duration(i) * time.Second); !tick.Equal(expected) {
+				t.Errorf("tick %v: expected %v, but received %v", i, expected, tick)
+			}
+		default:
+			t.Fatalf("tick %v: ticker did not fire", i)
+		}
+	}
+}
+
+func TestFake_NonPositiveTickMatchesReal(t *testing.T) {
+	clk := NewFake(time.Unix(0, 0))
+
+	for _, c := range []Clock{Real{}, clk} {
+		if tick := c.Tick(0); tick != nil {
+			t.Errorf("%T: expected nil channel, but received %v", c, tick)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected NewTicker with a non-positive interval to panic like time.NewTicker")
+		}
+	}()
+	clk.NewTicker(0)
+}
+
+func TestFake_BlockUntilWaitsForWaiters(t *testing.T) {
+	clk := NewFake(epoch)
+
+	fired := make(chan time.Time)
+	go func() {
+		fired <- <-clk.After(time.Minute)
+	}()
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("test timed out")
+	}
+}
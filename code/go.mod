@@ -1,5 +1,5 @@
 module code
 
-go 1.15
+go 1.21
 
-require golang.org/x/time v0.3.0 // indirect
+require golang.org/x/time v0.3.0
@@ -0,0 +1,329 @@
+// Package heartbeat 将第5章心跳示例中消费者手写的select循环(同时等待heartbeat results和超时)
+// 抽取为可复用的Monitor 并在此基础上提供健康状态 心跳抖动和漏跳统计
+package heartbeat
+
+import (
+	"code/clock"
+	"math"
+	"sync"
+	"time"
+)
+
+// State 被监视的goroutine的健康状态
+type State int
+
+const (
+	// Healthy 在期望的间隔内收到了心跳或结果
+	Healthy State = iota
+	// Degraded 连续漏掉的心跳数达到Config.DegradedAfter
+	Degraded
+	// Dead 连续漏掉的心跳数达到Config.DeadAfter 或heartbeat channel被关闭
+	Dead
+	// Stalled 仍然收到心跳 但心跳携带的Progress连续Config.StallAfter次没有进展
+	Stalled
+)
+
+func (s State) String() string {
+	switch s {
+	case Healthy:
+		return "Healthy"
+	case Degraded:
+		return "Degraded"
+	case Dead:
+		return "Dead"
+	case Stalled:
+		return "Stalled"
+	default:
+		return "Unknown"
+	}
+}
+
+// DefaultInterval Config.Interval<=0时期望的心跳间隔
+const DefaultInterval = 1 * time.Second
+
+type Config struct {
+	// Interval 期望的心跳间隔 即被监视的goroutine的pulseInterval <=0时为DefaultInterval
+	Interval time.Duration
+	// DegradedAfter 连续漏掉多少次心跳后进入Degraded <=0时为1
+	DegradedAfter int
+	// DeadAfter 连续漏掉多少次心跳后进入Dead <=DegradedAfter时为DegradedAfter+2
+	DeadAfter int
+	// StallAfter 心跳携带Progress时 连续多少次心跳没有进展后进入Stalled <=0表示不检测停滞
+	StallAfter int
+	// OnStateChange 状态变化时在Monitor的goroutine中被调用 不应阻塞
+	OnStateChange func(Change)
+	// Clock 为nil时使用真实时钟
+	Clock clock.Clock
+}
+
+// Change 一次状态变化
+type Change struct {
+	From   State
+	To     State
+	Time   time.Time
+	Missed int // 状态变化时连续漏掉的心跳数
+}
+
+// Stats 心跳统计
+type Stats struct {
+	Beats   int // 收到的心跳数
+	Results int // 收到的结果数
+	// Missed 漏掉的心跳总数 每经过一个Interval没有收到任何心跳或结果 计为漏掉1次
+	Missed int
+	// ConsecutiveMissed 当前连续漏掉的心跳数
+	ConsecutiveMissed int
+	LastBeat          time.Time
+	// MeanInterval 相邻两次心跳间隔的平均值
+	MeanInterval time.Duration
+	// Jitter 相邻两次心跳间隔的标准差
+	Jitter time.Duration
+	// MaxInterval 相邻两次心跳间隔的最大值
+	MaxInterval time.Duration
+	// Progress 最近一次携带Progress的心跳中的进度
+	Progress Progress
+	// UnchangedBeats 连续没有进展的心跳数
+	UnchangedBeats int
+}
+
+// Monitor 监视一对(heartbeat, results) channel
+// 结果通过Results()转发给调用方 转发期间仍然持续监视心跳 因此调用方读取结果较慢不会被误判为漏跳
+type Monitor[T any] struct {
+	config  Config
+	clk     clock.Clock
+	results chan T
+	changes chan Change
+
+	mu    sync.Mutex
+	state State
+	stats Stats
+	// exited heartbeat已被关闭 此后状态保持为Dead
+	exited bool
+	stall  *StallDetector
+	// intervals 相邻两次心跳间隔的个数 以及用于计算标准差的均值和平方差之和(Welford算法)
+	intervals int
+	mean      float64
+	m2        float64
+}
+
+// NewMonitor 启动一个goroutine监视heartbeat和results 直到done被关闭 或heartbeat和results都被关闭
+// 此后Results()和Changes()返回的channel被关闭
+func NewMonitor[T any](done <-chan interface{}, heartbeat <-chan interface{}, results <-chan T, config Config) *Monitor[T] {
+	// Interval为0时定时器立即到期 Monitor会不停地记录漏跳
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.DegradedAfter <= 0 {
+		config.DegradedAfter = 1
+	}
+	if config.DeadAfter <= config.DegradedAfter {
+		config.DeadAfter = config.DegradedAfter + 2
+	}
+
+	m := &Monitor[T]{
+		config:  config,
+		clk:     clock.OrReal(config.Clock),
+		results: make(chan T),
+		changes: make(chan Change, 16),
+	}
+	if config.StallAfter > 0 {
+		m.stall = NewStallDetector(config.StallAfter)
+	}
+
+	go m.run(done, heartbeat, results)
+	return m
+}
+
+// Results 被监视的goroutine产生的结果
+func (m *Monitor[T]) Results() <-chan T {
+	return m.results
+}
+
+// Changes 状态变化 缓冲区已满时新的变化会被丢弃 需要可靠通知时使用Config.OnStateChange
+func (m *Monitor[T]) Changes() <-chan Change {
+	return m.changes
+}
+
+func (m *Monitor[T]) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.state
+}
+
+func (m *Monitor[T]) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.stats
+}
+
+func (m *Monitor[T]) run(done <-chan interface{}, heartbeat <-chan interface{}, results <-chan T) {
+	defer close(m.changes)
+	defer close(m.results)
+
+	timer := m.clk.NewTimer(m.config.Interval)
+	defer timer.Stop()
+
+	resetTimer := func() {
+		if !timer.Stop() {
+			select {
+			case <-timer.C():
+			default:
+			}
+		}
+		timer.Reset(m.config.Interval)
+	}
+
+	// 正在等待调用方读取的结果 out为nil表示没有 此时不再从results读取 以免结果丢失
+	var pending T
+	var out chan<- T
+	in := results
+
+	for heartbeat != nil || in != nil || out != nil {
+		select {
+		case <-done:
+			return
+		case pulse, ok := <-heartbeat:
+			if !ok {
+				heartbeat = nil
+				m.heartbeatClosed()
+				continue
+			}
+			resetTimer()
+			m.beat(pulse)
+		case r, ok := <-in:
+			if !ok {
+				in = nil
+				results = nil
+				continue
+			}
+			resetTimer()
+			m.result()
+			pending, out, in = r, m.results, nil
+		case out <- pending:
+			var zero T
+			pending, out, in = zero, nil, results
+		case <-timer.C():
+			// heartbeat被关闭后 只需等待剩余的结果被读取
+			if heartbeat != nil {
+				m.miss()
+			}
+			timer.Reset(m.config.Interval)
+		}
+	}
+}
+
+// beat pulse为Progress时检测停滞 其他类型的心跳只说明goroutine还活着
+func (m *Monitor[T]) beat(pulse interface{}) {
+	now := m.clk.Now()
+
+	m.mu.Lock()
+	if !m.stats.LastBeat.IsZero() {
+		m.observeIntervalLocked(now.Sub(m.stats.LastBeat))
+	}
+	m.stats.Beats++
+	m.stats.LastBeat = now
+	m.stats.ConsecutiveMissed = 0
+
+	state := Healthy
+	if progress, ok := pulse.(Progress); ok {
+		m.stats.Progress = progress
+		if m.stall != nil {
+			if m.stall.Observe(progress) {
+				state = Stalled
+			}
+			m.stats.UnchangedBeats = m.stall.Unchanged()
+		}
+	}
+	change, changed := m.setStateLocked(state, now)
+	m.mu.Unlock()
+
+	if changed {
+		m.notify(change)
+	}
+}
+
+// result 收到结果说明goroutine有进展 即使它之前处于停滞状态
+func (m *Monitor[T]) result() {
+	now := m.clk.Now()
+
+	m.mu.Lock()
+	m.stats.Results++
+	m.stats.ConsecutiveMissed = 0
+	change, changed := m.setStateLocked(Healthy, now)
+	m.mu.Unlock()
+
+	if changed {
+		m.notify(change)
+	}
+}
+
+func (m *Monitor[T]) miss() {
+	now := m.clk.Now()
+
+	m.mu.Lock()
+	m.stats.Missed++
+	m.stats.ConsecutiveMissed++
+
+	state := m.state
+	switch {
+	case m.stats.ConsecutiveMissed >= m.config.DeadAfter:
+		state = Dead
+	case m.stats.ConsecutiveMissed >= m.config.DegradedAfter:
+		state = Degraded
+	}
+	change, changed := m.setStateLocked(state, now)
+	m.mu.Unlock()
+
+	if changed {
+		m.notify(change)
+	}
+}
+
+// heartbeatClosed heartbeat被关闭说明被监视的goroutine已经退出 无论之前是什么状态 都进入Dead
+func (m *Monitor[T]) heartbeatClosed() {
+	now := m.clk.Now()
+
+	m.mu.Lock()
+	change, changed := m.setStateLocked(Dead, now)
+	m.exited = true
+	m.mu.Unlock()
+
+	if changed {
+		m.notify(change)
+	}
+}
+
+func (m *Monitor[T]) setStateLocked(state State, now time.Time) (Change, bool) {
+	if state == m.state || m.exited {
+		return Change{}, false
+	}
+
+	change := Change{From: m.state, To: state, Time: now, Missed: m.stats.ConsecutiveMissed}
+	m.state = state
+	return change, true
+}
+
+func (m *Monitor[T]) observeIntervalLocked(interval time.Duration) {
+	m.intervals++
+	delta := float64(interval) - m.mean
+	m.mean += delta / float64(m.intervals)
+	m.m2 += delta * (float64(interval) - m.mean)
+
+	m.stats.MeanInterval = time.Duration(m.mean)
+	m.stats.Jitter = time.Duration(math.Sqrt(m.m2 / float64(m.intervals)))
+	if interval > m.stats.MaxInterval {
+		m.stats.MaxInterval = interval
+	}
+}
+
+func (m *Monitor[T]) notify(change Change) {
+	if m.config.OnStateChange != nil {
+		m.config.OnStateChange(change)
+	}
+
+	select {
+	case m.changes <- change:
+	default:
+	}
+}
@@ -0,0 +1,181 @@
+package heartbeat
+
+import (
+	"code/clock"
+	"testing"
+	"time"
+)
+
+const interval = 1 * time.Second
+
+// waitFor 轮询condition 直到其返回true或超时
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(1 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+// advance 每次最多推进一个interval 每次推进前等待Monitor的定时器就绪 推进满一个interval时等待Monitor记录漏跳
+func advance(t *testing.T, clk *clock.Fake, m *Monitor[int], d time.Duration) {
+	t.Helper()
+
+	for d > 0 {
+		step := d
+		if step > interval {
+			step = interval
+		}
+		d -= step
+
+		missed := m.Stats().Missed
+		clk.BlockUntil(1)
+		clk.Advance(step)
+		if step == interval {
+			waitFor(t, func() bool { return m.Stats().Missed == missed+1 })
+		}
+	}
+}
+
+func beat(t *testing.T, heartbeat chan interface{}, m *Monitor[int]) {
+	t.Helper()
+
+	beats := m.Stats().Beats
+	heartbeat <- struct{}{}
+	waitFor(t, func() bool { return m.Stats().Beats == beats+1 })
+}
+
+func TestMonitor_StateTransitions(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	done := make(chan interface{})
+	defer close(done)
+	heartbeat := make(chan interface{})
+
+	var callbacks []Change
+	m := NewMonitor[int](done, heartbeat, nil, Config{
+		Interval:      interval,
+		DegradedAfter: 1,
+		DeadAfter:     3,
+		Clock:         clk,
+		OnStateChange: func(change Change) { callbacks = append(callbacks, change) },
+	})
+
+	advance(t, clk, m, interval)
+	if m.State() != Degraded {
+		t.Fatalf("expected %v, but received %v", Degraded, m.State())
+	}
+
+	advance(t, clk, m, 2*interval)
+	if m.State() != Dead {
+		t.Fatalf("expected %v, but received %v", Dead, m.State())
+	}
+
+	beat(t, heartbeat, m)
+	if m.State() != Healthy {
+		t.Fatalf("expected %v, but received %v", Healthy, m.State())
+	}
+
+	expected := []State{Degraded, Dead, Healthy}
+	for _, state := range expected {
+		change := <-m.Changes()
+		if change.To != state {
+			t.Errorf("expected change to %v, but received %v", state, change.To)
+		}
+	}
+	if len(callbacks) != len(expected) {
+		t.Errorf("expected %v callbacks, but received %v", len(expected), len(callbacks))
+	}
+	if callbacks[1].Missed != 3 {
+		t.Errorf("expected Dead after 3 missed beats, but received %v", callbacks[1].Missed)
+	}
+}
+
+func TestMonitor_NonPositiveIntervalUsesDefault(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	done := make(chan interface{})
+	defer close(done)
+
+	m := NewMonitor[int](done, make(chan interface{}), nil, Config{Clock: clk})
+
+	clk.BlockUntil(1)
+	time.Sleep(10 * time.Millisecond)
+	if missed := m.Stats().Missed; missed != 0 {
+		t.Fatalf("expected no missed beats before any time passed, but received %v", missed)
+	}
+
+	clk.Advance(DefaultInterval)
+	waitFor(t, func() bool { return m.Stats().Missed == 1 })
+}
+
+func TestMonitor_JitterStatistics(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	done := make(chan interface{})
+	defer close(done)
+	heartbeat := make(chan interface{})
+
+	m := NewMonitor[int](done, heartbeat, nil, Config{Interval: interval, Clock: clk})
+
+	beat(t, heartbeat, m)
+	for _, d := range []time.Duration{interval / 2, interval / 2, 2 * interval} {
+		advance(t, clk, m, d)
+		beat(t, heartbeat, m)
+	}
+
+	stats := m.Stats()
+	if stats.Beats != 4 || stats.Missed != 2 {
+		t.Errorf("expected 4 beats and 2 missed, but received %v and %v", stats.Beats, stats.Missed)
+	}
+	if stats.MeanInterval != interval {
+		t.Errorf("expected mean interval %v, but received %v", interval, stats.MeanInterval)
+	}
+	if jitter := stats.Jitter; jitter < 700*time.Millisecond || jitter > 720*time.Millisecond {
+		t.Errorf("expected jitter about 707ms, but received %v", jitter)
+	}
+	if stats.MaxInterval != 2*interval {
+		t.Errorf("expected max interval %v, but received %v", 2*interval, stats.MaxInterval)
+	}
+}
+
+func TestMonitor_ForwardsResultsWithoutStallingHeartbeats(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	done := make(chan interface{})
+	defer close(done)
+	heartbeat := make(chan interface{})
+	results := make(chan int)
+
+	m := NewMonitor(done, heartbeat, results, Config{Interval: interval, Clock: clk})
+
+	results <- 1
+	// 调用方尚未读取结果 心跳仍然被处理
+	beat(t, heartbeat, m)
+	beat(t, heartbeat, m)
+
+	if r := <-m.Results(); r != 1 {
+		t.Errorf("expected result 1, but received %v", r)
+	}
+	if stats := m.Stats(); stats.Results != 1 {
+		t.Errorf("expected 1 result, but received %v", stats.Results)
+	}
+
+	close(heartbeat)
+	waitFor(t, func() bool { return m.State() == Dead })
+
+	// heartbeat被关闭后 剩余的结果仍然被转发 状态保持Dead
+	go func() {
+		results <- 2
+		close(results)
+	}()
+	if r := <-m.Results(); r != 2 {
+		t.Errorf("expected result 2, but received %v", r)
+	}
+	if _, ok := <-m.Results(); ok {
+		t.Error("expected results to be closed")
+	}
+	if m.State() != Dead {
+		t.Errorf("expected %v, but received %v", Dead, m.State())
+	}
+}
@@ -0,0 +1,58 @@
+package heartbeat
+
+// Progress 携带进度的心跳 代替struct{}{}发送到heartbeat channel上
+// 仅凭空心跳只能知道goroutine还活着 无法知道它是否在推进工作 例如卡在内层循环中的goroutine仍然会发出心跳
+type Progress struct {
+	// Processed 截至此次心跳已经处理完的条目数
+	Processed int
+	// CurrentID 正在处理的条目的ID 空闲时为空字符串
+	CurrentID string
+	// QueueDepth 等待处理的条目数
+	QueueDepth int
+}
+
+// busy 是否有正在处理或等待处理的条目
+func (p Progress) busy() bool {
+	return p.CurrentID != "" || p.QueueDepth > 0
+}
+
+// StallDetector 检测仍在发出心跳 但连续多次心跳之间没有任何进展的goroutine
+// 空闲的goroutine(没有正在处理和等待处理的条目)没有进展是正常的 不视为停滞
+type StallDetector struct {
+	after     int
+	last      Progress
+	seen      bool
+	unchanged int
+}
+
+// NewStallDetector 连续after次心跳没有进展时视为停滞 after<=0时为1
+func NewStallDetector(after int) *StallDetector {
+	if after <= 0 {
+		after = 1
+	}
+
+	return &StallDetector{after: after}
+}
+
+// Observe 记录一次心跳 返回goroutine是否处于停滞状态
+func (d *StallDetector) Observe(p Progress) bool {
+	if d.seen && p.busy() && p.Processed == d.last.Processed {
+		d.unchanged++
+	} else {
+		d.unchanged = 0
+	}
+
+	d.last = p
+	d.seen = true
+	return d.Stalled()
+}
+
+// Stalled 最近一次心跳时goroutine是否处于停滞状态
+func (d *StallDetector) Stalled() bool {
+	return d.unchanged >= d.after
+}
+
+// Unchanged 连续没有进展的心跳次数
+func (d *StallDetector) Unchanged() int {
+	return d.unchanged
+}
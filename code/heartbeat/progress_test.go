@@ -0,0 +1,33 @@
+package heartbeat
+
+import "testing"
+
+func TestStallDetector_FlagsBusyWorkerWithoutProgress(t *testing.T) {
+	d := NewStallDetector(2)
+
+	beats := []struct {
+		progress Progress
+		stalled  bool
+	}{
+		{Progress{Processed: 1, CurrentID: "a", QueueDepth: 3}, false},
+		{Progress{Processed: 1, CurrentID: "a", QueueDepth: 4}, false},
+		{Progress{Processed: 1, CurrentID: "a", QueueDepth: 5}, true},
+		{Progress{Processed: 2, CurrentID: "b", QueueDepth: 5}, false},
+	}
+
+	for i, beat := range beats {
+		if stalled := d.Observe(beat.progress); stalled != beat.stalled {
+			t.Errorf("beat %v: expected stalled %v, but received %v", i, beat.stalled, stalled)
+		}
+	}
+}
+
+func TestStallDetector_IdleWorkerIsNotStalled(t *testing.T) {
+	d := NewStallDetector(1)
+
+	for i := 0; i < 5; i++ {
+		if d.Observe(Progress{Processed: 7}) {
+			t.Fatalf("beat %v: expected idle worker not to be stalled", i)
+		}
+	}
+}
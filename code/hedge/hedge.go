@@ -0,0 +1,139 @@
+// Package hedge 对冲请求 推广了chapter5/15-replicateRequest
+// replicateRequest同时启动10个副本 每次调用都使负载变为10倍
+// Hedge先只发出1个请求 超过延迟仍未返回时才发出下一个副本 第一个成功的副本返回后取消其余副本
+package hedge
+
+import (
+	"code/clock"
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaxAttempts Policy.MaxAttempts<=0时最多发出的副本数
+const DefaultMaxAttempts = 2
+
+type Policy struct {
+	// Delay 发出下一个副本之前等待的时长 Tracker中的样本不足时使用
+	Delay time.Duration
+	// Tracker 非nil时 使用其中记录的延迟的Quantile分位数作为等待时长 并记录每次调用中第1个请求的延迟
+	// 只记录获胜副本的延迟会丢掉慢的第1个请求 使分位数越来越小 对冲越来越频繁
+	// 第1个请求输给其他副本时 记录的是它被取消前的耗时 即其实际延迟的下界
+	Tracker *LatencyTracker
+	// Quantile Tracker的分位数 不在(0, 1]之间时为0.95
+	Quantile float64
+	// MinSamples Tracker中至少有多少个样本时才使用分位数 <=0时为20
+	MinSamples int
+	// MaxAttempts 最多发出的副本数 包括第1个请求 <=0时为DefaultMaxAttempts
+	MaxAttempts int
+	// Clock 为nil时使用真实时钟
+	Clock clock.Clock
+}
+
+// Fn 一个副本 attempt为副本的序号 从0开始 ctx在其他副本获胜或调用方放弃时被取消
+type Fn[T any] func(ctx context.Context, attempt int) (T, error)
+
+type outcome[T any] struct {
+	value   T
+	err     error
+	attempt int
+}
+
+// Hedge 按policy发出副本 返回第一个成功的副本的结果及其序号
+// 某个副本失败时立即发出下一个副本 所有副本都失败时返回最后一个副本的错误
+// Hedge返回时取消所有尚未返回的副本 但不等待它们退出 因此fn必须在ctx被取消后尽快返回
+func Hedge[T any](ctx context.Context, fn Fn[T], policy Policy) (T, int, error) {
+	var zero T
+
+	clk := clock.OrReal(policy.Clock)
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	delay := policy.delay()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 缓冲区足够大 输掉的副本返回时不会阻塞
+	outcomes := make(chan outcome[T], maxAttempts)
+	// hedged 其他副本获胜 第1个请求因此被取消
+	var hedged atomic.Bool
+	launched := 0
+	launch := func() {
+		attempt := launched
+		launched++
+
+		started := clk.Now()
+		go func() {
+			value, err := fn(ctx, attempt)
+			// 在发送结果之前记录 第1个请求获胜时Hedge返回前已完成记录
+			if attempt == 0 && policy.Tracker != nil && (err == nil || hedged.Load()) {
+				policy.Tracker.Observe(clk.Since(started))
+			}
+			outcomes <- outcome[T]{value: value, err: err, attempt: attempt}
+		}()
+	}
+
+	launch()
+	timer := clk.NewTimer(delay)
+	defer timer.Stop()
+
+	failed := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return zero, -1, ctx.Err()
+		case o := <-outcomes:
+			if o.err == nil {
+				hedged.Store(o.attempt != 0)
+				return o.value, o.attempt, nil
+			}
+
+			failed++
+			if failed == maxAttempts {
+				return zero, o.attempt, o.err
+			}
+			if launched < maxAttempts {
+				launch()
+				resetTimer(timer, delay)
+			}
+		case <-timer.C():
+			if launched < maxAttempts {
+				launch()
+				timer.Reset(delay)
+			}
+		}
+	}
+}
+
+func (p Policy) delay() time.Duration {
+	if p.Tracker == nil {
+		return p.Delay
+	}
+
+	quantile := p.Quantile
+	if quantile <= 0 || quantile > 1 {
+		quantile = 0.95
+	}
+	minSamples := p.MinSamples
+	if minSamples <= 0 {
+		minSamples = 20
+	}
+
+	if p.Tracker.Len() < minSamples {
+		return p.Delay
+	}
+
+	return p.Tracker.Quantile(quantile)
+}
+
+func resetTimer(timer clock.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C():
+		default:
+		}
+	}
+	timer.Reset(d)
+}
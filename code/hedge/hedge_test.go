@@ -0,0 +1,193 @@
+package hedge
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// backend 模拟延迟服从某个分布的下游 记录发出的副本数和被取消的副本数
+type backend struct {
+	latency   func(attempt int) time.Duration
+	attempts  int64
+	cancelled int64
+}
+
+func (b *backend) call(ctx context.Context, attempt int) (int, error) {
+	atomic.AddInt64(&b.attempts, 1)
+
+	select {
+	case <-ctx.Done():
+		atomic.AddInt64(&b.cancelled, 1)
+		return 0, ctx.Err()
+	case <-time.After(b.latency(attempt)):
+		return attempt, nil
+	}
+}
+
+func TestHedge_SlowFirstAttemptLosesToHedge(t *testing.T) {
+	b := &backend{latency: func(attempt int) time.Duration {
+		if attempt == 0 {
+			return 1 * time.Second
+		}
+		return 5 * time.Millisecond
+	}}
+
+	start := time.Now()
+	value, attempt, err := Hedge(context.Background(), b.call, Policy{Delay: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attempt != 1 || value != 1 {
+		t.Errorf("expected attempt 1 to win, but received attempt %v", attempt)
+	}
+	if took := time.Since(start); took > 500*time.Millisecond {
+		t.Errorf("expected hedge to cut latency, but took %v", took)
+	}
+
+	// 输掉的副本通过ctx被取消
+	deadline := time.Now().Add(1 * time.Second)
+	for atomic.LoadInt64(&b.cancelled) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected losing attempt to be cancelled")
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+func TestHedge_FastFirstAttemptSendsNoHedge(t *testing.T) {
+	b := &backend{latency: func(int) time.Duration { return 1 * time.Millisecond }}
+
+	if _, attempt, err := Hedge(context.Background(), b.call, Policy{Delay: 100 * time.Millisecond}); err != nil || attempt != 0 {
+		t.Fatalf("expected attempt 0 to win, but received attempt %v and %v", attempt, err)
+	}
+	if attempts := atomic.LoadInt64(&b.attempts); attempts != 1 {
+		t.Errorf("expected 1 attempt, but received %v", attempts)
+	}
+}
+
+func TestHedge_CapsAttempts(t *testing.T) {
+	b := &backend{latency: func(int) time.Duration { return time.Hour }}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, _, err := Hedge(ctx, b.call, Policy{Delay: 1 * time.Millisecond, MaxAttempts: 3})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, but received %v", context.DeadlineExceeded, err)
+	}
+
+	if attempts := atomic.LoadInt64(&b.attempts); attempts != 3 {
+		t.Errorf("expected 3 attempts, but received %v", attempts)
+	}
+}
+
+func TestHedge_FailureStartsNextAttemptImmediately(t *testing.T) {
+	errBoom := errors.New("boom")
+	fn := func(ctx context.Context, attempt int) (string, error) {
+		if attempt < 2 {
+			return "", errBoom
+		}
+		return "ok", nil
+	}
+
+	start := time.Now()
+	value, attempt, err := Hedge(context.Background(), fn, Policy{Delay: time.Hour, MaxAttempts: 3})
+	if err != nil || value != "ok" || attempt != 2 {
+		t.Fatalf("expected attempt 2 to succeed, but received %v %v %v", value, attempt, err)
+	}
+	if took := time.Since(start); took > 500*time.Millisecond {
+		t.Errorf("expected failures not to wait for the hedge delay, but took %v", took)
+	}
+
+	_, _, err = Hedge(context.Background(), func(context.Context, int) (string, error) {
+		return "", errBoom
+	}, Policy{MaxAttempts: 2})
+	if !errors.Is(err, errBoom) {
+		t.Errorf("expected %v when every attempt fails, but received %v", errBoom, err)
+	}
+}
+
+func TestHedge_P95DelayCutsTailLatency(t *testing.T) {
+	// 95%的请求耗时约2ms 5%的请求耗时200ms
+	var mu sync.Mutex
+	r := rand.New(rand.NewSource(1))
+	b := &backend{latency: func(int) time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Float64() < 0.05 {
+			return 200 * time.Millisecond
+		}
+		return time.Duration(1+r.Intn(2)) * time.Millisecond
+	}}
+
+	policy := Policy{Delay: 20 * time.Millisecond, Tracker: NewLatencyTracker(100), MinSamples: 20}
+	const calls = 200
+	latencies := make([]time.Duration, calls)
+	for i := range latencies {
+		start := time.Now()
+		if _, _, err := Hedge(context.Background(), b.call, policy); err != nil {
+			t.Fatal(err)
+		}
+		latencies[i] = time.Since(start)
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	if p99 := latencies[calls*99/100]; p99 > 100*time.Millisecond {
+		t.Errorf("expected hedging to keep p99 well below 200ms, but received %v", p99)
+	}
+
+	// 只有慢于p95的请求才会发出第2个副本
+	if load := float64(atomic.LoadInt64(&b.attempts)) / calls; load > 1.3 {
+		t.Errorf("expected at most 30%% extra load, but received %.2fx", load)
+	}
+}
+
+func TestHedge_TrackerRecordsSlowFirstAttempt(t *testing.T) {
+	b := &backend{latency: func(attempt int) time.Duration {
+		if attempt == 0 {
+			return 1 * time.Second
+		}
+		return 1 * time.Millisecond
+	}}
+
+	tracker := NewLatencyTracker(10)
+	if _, attempt, err := Hedge(context.Background(), b.call, Policy{Delay: 20 * time.Millisecond, Tracker: tracker}); err != nil || attempt != 1 {
+		t.Fatalf("expected attempt 1 to win, but received attempt %v and %v", attempt, err)
+	}
+
+	// 输掉的第1个请求在被取消后记录 其延迟不小于发出对冲副本前的等待时长
+	deadline := time.Now().Add(1 * time.Second)
+	for tracker.Len() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the first attempt to be recorded")
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	if latency := tracker.Quantile(1); latency < 20*time.Millisecond {
+		t.Errorf("expected the first attempt's latency of at least 20ms, but received %v", latency)
+	}
+}
+
+func TestLatencyTracker_Quantile(t *testing.T) {
+	tracker := NewLatencyTracker(10)
+	for i := 1; i <= 20; i++ {
+		tracker.Observe(time.Duration(i) * time.Millisecond)
+	}
+
+	// 只保留最近10个样本 即11ms到20ms
+	if tracker.Len() != 10 {
+		t.Errorf("expected 10 samples, but received %v", tracker.Len())
+	}
+	if p95 := tracker.Quantile(0.95); p95 != 20*time.Millisecond {
+		t.Errorf("expected p95 20ms, but received %v", p95)
+	}
+	if p50 := tracker.Quantile(0.5); p50 != 15*time.Millisecond {
+		t.Errorf("expected p50 15ms, but received %v", p50)
+	}
+}
@@ -0,0 +1,77 @@
+package hedge
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyTracker 记录最近window个延迟样本 用于计算对冲的等待时长
+type LatencyTracker struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+// NewLatencyTracker window<=0时为100
+func NewLatencyTracker(window int) *LatencyTracker {
+	if window <= 0 {
+		window = 100
+	}
+
+	return &LatencyTracker{samples: make([]time.Duration, window)}
+}
+
+// Observe 记录一个样本 样本数超过window时覆盖最旧的样本
+func (t *LatencyTracker) Observe(latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.samples[t.next] = latency
+	t.next = (t.next + 1) % len(t.samples)
+	if t.next == 0 {
+		t.full = true
+	}
+}
+
+// Len 当前的样本数
+func (t *LatencyTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.lenLocked()
+}
+
+// Quantile 返回样本的q分位数(最近秩法) 没有样本时返回0
+func (t *LatencyTracker) Quantile(q float64) time.Duration {
+	t.mu.Lock()
+	n := t.lenLocked()
+	sorted := make([]time.Duration, n)
+	copy(sorted, t.samples[:n])
+	t.mu.Unlock()
+
+	if n == 0 {
+		return 0
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(q*float64(n))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= n {
+		rank = n - 1
+	}
+
+	return sorted[rank]
+}
+
+func (t *LatencyTracker) lenLocked() int {
+	if t.full {
+		return len(t.samples)
+	}
+
+	return t.next
+}
@@ -0,0 +1,37 @@
+package pipeline
+
+import "context"
+
+// Bridge 将一个由channel组成的channel拆解为一个简单的channel 按chanStream中channel的顺序依次读取其中的值
+func Bridge[T any](ctx context.Context, chanStream <-chan <-chan T) <-chan T {
+	valueStream := make(chan T)
+
+	go func() {
+		defer close(valueStream)
+
+		for {
+			var stream <-chan T
+
+			select {
+			case maybeStream, ok := <-chanStream:
+				if !ok {
+					return
+				}
+
+				stream = maybeStream
+			case <-ctx.Done():
+				return
+			}
+
+			for value := range OrDone(ctx, stream) {
+				select {
+				case valueStream <- value:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return valueStream
+}
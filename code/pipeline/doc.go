@@ -0,0 +1,3 @@
+// Package pipeline 将第4章中各示例反复声明的管道阶段(repeat take orDone tee bridge fanIn)
+// 抽取为可导入的泛型版本 并使用context.Context代替done channel来控制goroutine的退出
+package pipeline
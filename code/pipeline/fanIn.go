@@ -0,0 +1,38 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// FanIn 将多个channel中的值合并(多路复用)到返回的channel中 返回的channel中值的顺序是不确定的
+// 所有给定的channel都关闭(或ctx被取消)后 返回的channel才会被关闭
+func FanIn[T any](ctx context.Context, channels ...<-chan T) <-chan T {
+	var wg sync.WaitGroup
+	multiplexedStream := make(chan T)
+
+	multiplex := func(c <-chan T) {
+		defer wg.Done()
+		for i := range OrDone(ctx, c) {
+			select {
+			case <-ctx.Done():
+				return
+			case multiplexedStream <- i:
+			}
+		}
+	}
+
+	// 从所有channel中取值
+	wg.Add(len(channels))
+	for _, c := range channels {
+		go multiplex(c)
+	}
+
+	// 等待所有数据汇总完毕
+	go func() {
+		wg.Wait()
+		close(multiplexedStream)
+	}()
+
+	return multiplexedStream
+}
@@ -0,0 +1,32 @@
+package pipeline
+
+import "context"
+
+// OrDone 封装对c的读取 使得调用者可以直接使用for range读取c 而无需再关心ctx是否被取消
+func OrDone[T any](ctx context.Context, c <-chan T) <-chan T {
+	valueStream := make(chan T)
+
+	go func() {
+		defer close(valueStream)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-c:
+				// 若给定的channel关闭 也直接返回
+				if !ok {
+					return
+				}
+
+				select {
+				case valueStream <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return valueStream
+}
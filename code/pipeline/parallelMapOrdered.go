@@ -0,0 +1,98 @@
+package pipeline
+
+import "context"
+
+// sequenced 为值附加一个序号 用于在并行处理后恢复输入的顺序
+type sequenced[T any] struct {
+	seq   uint64
+	value T
+}
+
+// ParallelMapOrdered 启动workers个goroutine并行地对in中的每个值调用fn 并按in中值的顺序输出结果
+// 与FanIn不同 本函数会为每个输入附加序号 再通过一个有界的重排序缓冲区恢复顺序
+// 处理中(已读取但尚未输出)的值最多为2*workers个 某个值处理较慢时 后续的值最多积压这么多个
+func ParallelMapOrdered[T, R any](ctx context.Context, in <-chan T, workers int, fn func(T) R) <-chan R {
+	if workers < 1 {
+		workers = 1
+	}
+
+	// slots 限制处理中的值的数量 也就是重排序缓冲区的上限
+	window := 2 * workers
+	slots := make(chan struct{}, window)
+
+	taggedStream := make(chan sequenced[T])
+	go func() {
+		defer close(taggedStream)
+
+		var seq uint64
+		for value := range OrDone(ctx, in) {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case taggedStream <- sequenced[T]{seq: seq, value: value}:
+			case <-ctx.Done():
+				return
+			}
+			seq++
+		}
+	}()
+
+	// fan-out
+	worker := func() <-chan sequenced[R] {
+		resultStream := make(chan sequenced[R])
+
+		go func() {
+			defer close(resultStream)
+
+			for tagged := range taggedStream {
+				select {
+				case resultStream <- sequenced[R]{seq: tagged.seq, value: fn(tagged.value)}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		return resultStream
+	}
+
+	resultStreams := make([]<-chan sequenced[R], workers)
+	for i := 0; i < workers; i++ {
+		resultStreams[i] = worker()
+	}
+
+	// fan-in 之后按序号重排序
+	orderedStream := make(chan R)
+	go func() {
+		defer close(orderedStream)
+
+		pending := make(map[uint64]R, window)
+		var next uint64
+		for result := range FanIn(ctx, resultStreams...) {
+			pending[result.seq] = result.value
+
+			for {
+				value, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+
+				select {
+				case orderedStream <- value:
+				case <-ctx.Done():
+					return
+				}
+
+				<-slots
+				next++
+			}
+		}
+	}()
+
+	return orderedStream
+}
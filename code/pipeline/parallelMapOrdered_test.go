@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestParallelMapOrdered_KeepsInputOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const total = 200
+	in := make(chan int)
+	go func() {
+		defer close(in)
+		for i := 0; i < total; i++ {
+			in <- i
+		}
+	}()
+
+	// 随机的处理时长使得各worker完成的顺序与输入顺序不同
+	square := func(v int) int {
+		time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+		return v * v
+	}
+
+	i := 0
+	for result := range ParallelMapOrdered(ctx, in, 8, square) {
+		if expected := i * i; result != expected {
+			t.Fatalf("index %v: expected %v, but received %v", i, expected, result)
+		}
+		i++
+	}
+
+	if i != total {
+		t.Errorf("expected %v results, but received %v", total, i)
+	}
+}
+
+func TestParallelMapOrdered_BoundsInFlightItems(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const workers = 2
+	read := make(chan int, 100)
+	in := RepeatFn(ctx, func() int {
+		v := len(read)
+		read <- v
+		return v
+	})
+
+	// 第0个值永远不会处理完 因此最多只能从in中读取2*workers个值
+	block := make(chan struct{})
+	stream := ParallelMapOrdered(ctx, in, workers, func(v int) int {
+		if v == 0 {
+			<-block
+		}
+		return v
+	})
+
+	time.Sleep(100 * time.Millisecond)
+	// RepeatFn、OrDone以及等待空位的分发goroutine各自会多持有1个值 因此允许多出3个
+	if max := 2*workers + 3; len(read) > max {
+		t.Errorf("expected at most %v values read, but read %v", max, len(read))
+	}
+
+	close(block)
+	for i := 0; i < 10; i++ {
+		if v := <-stream; v != i {
+			t.Fatalf("index %v: expected %v, but received %v", i, i, v)
+		}
+	}
+}
+
+func TestParallelMapOrdered_StopsOnCancel(t *testing.T) {
+	base := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stream := ParallelMapOrdered(ctx, Repeat(ctx, 1), 4, func(v int) int { return v })
+	<-stream
+	cancel()
+	waitGoroutines(t, base)
+}
+
+// isPrime 与第4章中primeFinder使用的判断方式相同 故意使用低效的算法以模拟耗时的阶段
+func isPrime(integer int) bool {
+	for divisor := integer - 1; divisor > 1; divisor-- {
+		if integer%divisor == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func randIntStream(ctx context.Context) <-chan int {
+	return RepeatFn(ctx, func() int { return rand.Intn(50000) })
+}
+
+func BenchmarkParallelMapOrdered(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b.ResetTimer()
+	for range Take(ctx, ParallelMapOrdered(ctx, randIntStream(ctx), runtime.NumCPU(), isPrime), b.N) {
+	}
+}
+
+func BenchmarkFanInUnordered(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	intStream := randIntStream(ctx)
+	finder := func() <-chan bool {
+		resultStream := make(chan bool)
+		go func() {
+			defer close(resultStream)
+			for integer := range intStream {
+				select {
+				case <-ctx.Done():
+					return
+				case resultStream <- isPrime(integer):
+				}
+			}
+		}()
+		return resultStream
+	}
+
+	finders := make([]<-chan bool, runtime.NumCPU())
+	for i := range finders {
+		finders[i] = finder()
+	}
+
+	b.ResetTimer()
+	for range Take(ctx, FanIn(ctx, finders...), b.N) {
+	}
+}
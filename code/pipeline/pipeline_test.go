@@ -0,0 +1,206 @@
+package pipeline
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+// waitGoroutines 等待当前goroutine数量回落到base以下 超时则认为有goroutine在ctx取消后仍未退出
+func waitGoroutines(t *testing.T, base int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > base {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			n := runtime.Stack(buf, true)
+			t.Fatalf("goroutine leaked: expected at most %d, but got %d\n%s", base, runtime.NumGoroutine(), buf[:n])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRepeatAndTake_TakesInOrder(t *testing.T) {
+	base := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var got []int
+	for v := range Take(ctx, Repeat(ctx, 1, 2, 3), 7) {
+		got = append(got, v)
+	}
+
+	expected := []int{1, 2, 3, 1, 2, 3, 1}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, but received %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("index %v: expected %v, but received %v", i, expected[i], got[i])
+		}
+	}
+
+	cancel()
+	waitGoroutines(t, base)
+}
+
+func TestRepeatFn_StopsOnCancel(t *testing.T) {
+	base := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stream := RepeatFn(ctx, func() string { return "a" })
+	<-stream
+	cancel()
+
+	for range stream {
+	}
+	waitGoroutines(t, base)
+}
+
+func TestTake_StopsWhenInputClosed(t *testing.T) {
+	in := make(chan int, 2)
+	in <- 1
+	in <- 2
+	close(in)
+
+	count := 0
+	for range Take(context.Background(), in, 5) {
+		count++
+	}
+
+	if count != 2 {
+		t.Errorf("expected 2 values, but received %v", count)
+	}
+}
+
+func TestTake_CancelWhileWaitingForInput(t *testing.T) {
+	base := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// 输入channel永远不会有值 Take必须在读取时也响应取消
+	stream := Take(ctx, make(chan int), 1)
+	cancel()
+
+	if _, ok := <-stream; ok {
+		t.Fatal("expected closed stream after cancel")
+	}
+	waitGoroutines(t, base)
+}
+
+func TestOrDone_ClosesOnCancel(t *testing.T) {
+	base := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stream := OrDone(ctx, make(chan int))
+	cancel()
+
+	select {
+	case _, ok := <-stream:
+		if ok {
+			t.Fatal("expected closed stream")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("test timed out")
+	}
+	waitGoroutines(t, base)
+}
+
+func TestTee_BothOutputsReceiveAllValues(t *testing.T) {
+	base := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out1, out2 := Tee(ctx, Take(ctx, Repeat(ctx, 1, 2), 4))
+	for i := 0; i < 4; i++ {
+		v1, v2 := <-out1, <-out2
+		if v1 != v2 {
+			t.Errorf("index %v: out1 received %v, but out2 received %v", i, v1, v2)
+		}
+	}
+
+	cancel()
+	waitGoroutines(t, base)
+}
+
+func TestTee_CancelWithSlowReader(t *testing.T) {
+	base := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// 只读取out1 tee会阻塞在写入out2上 取消后必须能够退出
+	out1, _ := Tee(ctx, Repeat(ctx, 1))
+	<-out1
+	cancel()
+	waitGoroutines(t, base)
+}
+
+func TestBridge_FlattensInOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chanStream := make(chan (<-chan int))
+	go func() {
+		defer close(chanStream)
+		for i := 0; i < 3; i++ {
+			stream := make(chan int, 1)
+			stream <- i
+			close(stream)
+			chanStream <- stream
+		}
+	}()
+
+	i := 0
+	for v := range Bridge(ctx, chanStream) {
+		if v != i {
+			t.Errorf("expected %v, but received %v", i, v)
+		}
+		i++
+	}
+	if i != 3 {
+		t.Errorf("expected 3 values, but received %v", i)
+	}
+}
+
+func TestBridge_StopsOnCancel(t *testing.T) {
+	base := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	chanStream := make(chan (<-chan int), 1)
+	chanStream <- Repeat(ctx, 1)
+	stream := Bridge(ctx, chanStream)
+	<-stream
+	cancel()
+	waitGoroutines(t, base)
+}
+
+func TestFanIn_MergesAllValues(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var got []int
+	for v := range FanIn(ctx, Take(ctx, Repeat(ctx, 1), 2), Take(ctx, Repeat(ctx, 2), 2)) {
+		got = append(got, v)
+	}
+
+	sort.Ints(got)
+	expected := []int{1, 1, 2, 2}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, but received %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("index %v: expected %v, but received %v", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestFanIn_StopsOnCancel(t *testing.T) {
+	base := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stream := FanIn(ctx, Repeat(ctx, 1), Repeat(ctx, 2), Repeat(ctx, 3))
+	<-stream
+	cancel()
+	waitGoroutines(t, base)
+}
@@ -0,0 +1,47 @@
+package pipeline
+
+import "context"
+
+// Repeat 重复地将给定的值按顺序写入返回的channel 直到ctx被取消
+func Repeat[T any](ctx context.Context, values ...T) <-chan T {
+	valueStream := make(chan T)
+
+	go func() {
+		defer close(valueStream)
+
+		if len(values) == 0 {
+			return
+		}
+
+		for {
+			for _, value := range values {
+				select {
+				case <-ctx.Done():
+					return
+				case valueStream <- value:
+				}
+			}
+		}
+	}()
+
+	return valueStream
+}
+
+// RepeatFn 重复地调用fn 并将其返回值写入返回的channel 直到ctx被取消
+func RepeatFn[T any](ctx context.Context, fn func() T) <-chan T {
+	valueStream := make(chan T)
+
+	go func() {
+		defer close(valueStream)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case valueStream <- fn():
+			}
+		}
+	}()
+
+	return valueStream
+}
@@ -0,0 +1,171 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Result 在管道各阶段之间传递的信封 与第4章12-handleErrorInCaller中的Result作用相同
+// 将错误与值一起传递给拥有更多上下文信息的调用者 由调用者决定如何处理错误
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// TypeError 表示某个阶段收到的值的类型与期望的类型不符
+// 用于代替toInt中value.(int)断言失败时的panic
+type TypeError struct {
+	Value    interface{} // 实际收到的值
+	Expected string      // 期望的类型
+}
+
+func (e TypeError) Error() string {
+	return fmt.Sprintf("pipeline: expected value of type %s, but received %T(%v)", e.Expected, e.Value, e.Value)
+}
+
+// Lift 将普通的channel转换为Result的channel 以便接入可以传递错误的管道阶段
+func Lift[T any](ctx context.Context, in <-chan T) <-chan Result[T] {
+	resultStream := make(chan Result[T])
+
+	go func() {
+		defer close(resultStream)
+
+		for value := range OrDone(ctx, in) {
+			select {
+			case <-ctx.Done():
+				return
+			case resultStream <- Result[T]{Value: value}:
+			}
+		}
+	}()
+
+	return resultStream
+}
+
+// Map 对in中每个成功的结果调用fn 并将fn的返回值或错误写入返回的channel
+// in中已经携带错误的结果不会调用fn 而是原样向下游传递错误
+func Map[T, R any](ctx context.Context, in <-chan Result[T], fn func(T) (R, error)) <-chan Result[R] {
+	resultStream := make(chan Result[R])
+
+	go func() {
+		defer close(resultStream)
+
+		for result := range OrDone(ctx, in) {
+			var out Result[R]
+			if result.Err != nil {
+				out.Err = result.Err
+			} else {
+				out.Value, out.Err = fn(result.Value)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case resultStream <- out:
+			}
+		}
+	}()
+
+	return resultStream
+}
+
+// Assert 将in中的值断言为类型R 断言失败时向下游传递TypeError 而非panic
+func Assert[R any](ctx context.Context, in <-chan Result[interface{}]) <-chan Result[R] {
+	return Map(ctx, in, func(value interface{}) (R, error) {
+		r, ok := value.(R)
+		if !ok {
+			return r, TypeError{Value: value, Expected: reflect.TypeOf((*R)(nil)).Elem().String()}
+		}
+		return r, nil
+	})
+}
+
+// ToString 将in中的值通过fmt.Sprint转换为字符串
+func ToString[T any](ctx context.Context, in <-chan Result[T]) <-chan Result[string] {
+	return Map(ctx, in, func(value T) (string, error) {
+		return fmt.Sprint(value), nil
+	})
+}
+
+// StopAfterErrors 原样传递in中的结果 当收到第n个错误时 将该错误传递给下游后关闭返回的channel
+// 相当于12-handleErrorInCaller中errCounter >= 3时break的循环
+func StopAfterErrors[T any](ctx context.Context, in <-chan Result[T], n int) <-chan Result[T] {
+	resultStream := make(chan Result[T])
+
+	go func() {
+		defer close(resultStream)
+
+		errCounter := 0
+		for result := range OrDone(ctx, in) {
+			select {
+			case <-ctx.Done():
+				return
+			case resultStream <- result:
+			}
+
+			if result.Err != nil {
+				errCounter++
+				if errCounter >= n {
+					return
+				}
+			}
+		}
+	}()
+
+	return resultStream
+}
+
+// SkipErrors 丢弃in中携带错误的结果 只将成功的值写入返回的channel
+func SkipErrors[T any](ctx context.Context, in <-chan Result[T]) <-chan T {
+	valueStream := make(chan T)
+
+	go func() {
+		defer close(valueStream)
+
+		for result := range OrDone(ctx, in) {
+			if result.Err != nil {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case valueStream <- result.Value:
+			}
+		}
+	}()
+
+	return valueStream
+}
+
+// SplitErrors 将in中的结果拆分为值和错误两个channel
+// 与Tee相同 调用者需要同时读取两个channel 否则未被读取的一方会阻塞整个流
+func SplitErrors[T any](ctx context.Context, in <-chan Result[T]) (<-chan T, <-chan error) {
+	valueStream := make(chan T)
+	errStream := make(chan error)
+
+	go func() {
+		defer close(valueStream)
+		defer close(errStream)
+
+		for result := range OrDone(ctx, in) {
+			if result.Err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case errStream <- result.Err:
+				}
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case valueStream <- result.Value:
+			}
+		}
+	}()
+
+	return valueStream, errStream
+}
@@ -0,0 +1,150 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func mixedStream(ctx context.Context) <-chan Result[interface{}] {
+	return Take(ctx, Lift(ctx, Repeat[interface{}](ctx, 1, "two", 3)), 6)
+}
+
+func TestAssert_ReportsTypeErrorInsteadOfPanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var values []int
+	var errs []error
+	for result := range Assert[int](ctx, mixedStream(ctx)) {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+			continue
+		}
+		values = append(values, result.Value)
+	}
+
+	if !equalInts(values, []int{1, 3, 1, 3}) {
+		t.Errorf("expected [1 3 1 3], but received %v", values)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, but received %v", len(errs))
+	}
+
+	var typeErr TypeError
+	if !errors.As(errs[0], &typeErr) {
+		t.Fatalf("expected TypeError, but received %T", errs[0])
+	}
+	if typeErr.Expected != "int" || typeErr.Value != "two" {
+		t.Errorf("unexpected TypeError: %#v", typeErr)
+	}
+}
+
+func TestMap_PassesErrorsThrough(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	parse := func(s string) (int, error) { return strconv.Atoi(s) }
+	double := func(v int) (int, error) {
+		return v * 2, nil
+	}
+
+	in := Lift(ctx, Take(ctx, Repeat(ctx, "1", "x"), 2))
+	var results []Result[int]
+	for result := range Map(ctx, Map(ctx, in, parse), double) {
+		results = append(results, result)
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, but received %v", len(results))
+	}
+	if results[0].Err != nil || results[0].Value != 2 {
+		t.Errorf("expected 2, but received %#v", results[0])
+	}
+	var numErr *strconv.NumError
+	if !errors.As(results[1].Err, &numErr) {
+		t.Errorf("expected *strconv.NumError, but received %v", results[1].Err)
+	}
+}
+
+func TestStopAfterErrors_ShortCircuits(t *testing.T) {
+	base := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	errBad := errors.New("bad")
+	in := Repeat(ctx, Result[int]{Value: 1}, Result[int]{Err: errBad})
+
+	results := 0
+	errCounter := 0
+	for result := range StopAfterErrors(ctx, in, 3) {
+		results++
+		if result.Err != nil {
+			errCounter++
+		}
+	}
+
+	if errCounter != 3 || results != 6 {
+		t.Errorf("expected 6 results with 3 errors, but received %v results with %v errors", results, errCounter)
+	}
+
+	cancel()
+	waitGoroutines(t, base)
+}
+
+func TestSkipErrors_DropsBadItems(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var values []int
+	for v := range SkipErrors(ctx, Assert[int](ctx, mixedStream(ctx))) {
+		values = append(values, v)
+	}
+
+	if !equalInts(values, []int{1, 3, 1, 3}) {
+		t.Errorf("expected [1 3 1 3], but received %v", values)
+	}
+}
+
+func TestSplitErrors_SendsErrorsToSideChannel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	values, errs := SplitErrors(ctx, Assert[int](ctx, mixedStream(ctx)))
+
+	var gotValues []int
+	gotErrs := 0
+	for values != nil || errs != nil {
+		select {
+		case v, ok := <-values:
+			if !ok {
+				values = nil
+				continue
+			}
+			gotValues = append(gotValues, v)
+		case _, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			gotErrs++
+		}
+	}
+
+	if !equalInts(gotValues, []int{1, 3, 1, 3}) || gotErrs != 2 {
+		t.Errorf("expected [1 3 1 3] and 2 errors, but received %v and %v errors", gotValues, gotErrs)
+	}
+}
+
+func TestToString_FormatsValues(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var got []string
+	for result := range ToString(ctx, Lift(ctx, Take(ctx, Repeat(ctx, 1, 2), 2))) {
+		got = append(got, result.Value)
+	}
+
+	if len(got) != 2 || got[0] != "1" || got[1] != "2" {
+		t.Errorf("expected [1 2], but received %v", got)
+	}
+}
@@ -0,0 +1,35 @@
+package pipeline
+
+import "context"
+
+// Take 从valueStream中取出前num个值写入返回的channel
+// 与第4章中的take不同 本函数在读取valueStream时同样会响应ctx的取消 且valueStream关闭时会提前结束
+func Take[T any](ctx context.Context, valueStream <-chan T, num int) <-chan T {
+	takeStream := make(chan T)
+
+	go func() {
+		defer close(takeStream)
+
+		for i := 0; i < num; i++ {
+			var value T
+			var ok bool
+
+			select {
+			case <-ctx.Done():
+				return
+			case value, ok = <-valueStream:
+				if !ok {
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case takeStream <- value:
+			}
+		}
+	}()
+
+	return takeStream
+}
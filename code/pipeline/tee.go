@@ -0,0 +1,31 @@
+package pipeline
+
+import "context"
+
+// Tee 将in中的每个值同时写入返回的2个channel 只有当2个channel都读取了当前值后 才会继续从in中读取下一个值
+func Tee[T any](ctx context.Context, in <-chan T) (_, _ <-chan T) {
+	out1 := make(chan T)
+	out2 := make(chan T)
+
+	go func() {
+		defer close(out1)
+		defer close(out2)
+
+		for val := range OrDone(ctx, in) {
+			// 使用局部变量遮蔽out1和out2 写入成功后将局部变量置为nil 使得同一个值不会被重复写入同一个channel
+			out1, out2 := out1, out2
+			for i := 0; i < 2; i++ {
+				select {
+				case <-ctx.Done():
+					return
+				case out1 <- val:
+					out1 = nil
+				case out2 <- val:
+					out2 = nil
+				}
+			}
+		}
+	}()
+
+	return out1, out2
+}
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"context"
+	"reflect"
+)
+
+// SlowConsumerPolicy 定义当TeeN的某个分支缓冲区已满(即该分支的读取者跟不上)时的处理策略
+type SlowConsumerPolicy int
+
+const (
+	// Block 阻塞整个流 直到该分支读取了当前值 与Tee的行为一致
+	Block SlowConsumerPolicy = iota
+	// DropOldest 丢弃该分支缓冲区中最旧的值 再写入当前值 缓冲区大小为0时等同于DropNewest
+	DropOldest
+	// DropNewest 丢弃当前值 该分支缓冲区中已有的值保持不变
+	DropNewest
+	// Disconnect 关闭该分支的channel 此后不再向该分支写入任何值
+	Disconnect
+)
+
+// BranchOptions TeeN中单个分支的配置
+type BranchOptions struct {
+	BufferSize int                // 该分支channel的缓冲区大小
+	Policy     SlowConsumerPolicy // 该分支缓冲区已满时的处理策略
+}
+
+// TeeN 将in中的每个值写入返回的n个channel中
+// opts[i]为第i个分支的配置 未给出配置的分支使用零值 即无缓冲且策略为Block
+// 只有策略为Block的分支会阻塞整个流 其他策略的分支缓冲区已满时按各自的策略处理 不会拖慢其他分支
+func TeeN[T any](ctx context.Context, in <-chan T, n int, opts ...BranchOptions) []<-chan T {
+	branches := make([]chan T, n)
+	branchOpts := make([]BranchOptions, n)
+	outs := make([]<-chan T, n)
+	for i := 0; i < n; i++ {
+		if i < len(opts) {
+			branchOpts[i] = opts[i]
+		}
+		branches[i] = make(chan T, branchOpts[i].BufferSize)
+		outs[i] = branches[i]
+	}
+
+	go func() {
+		// 已断开的分支会被置为nil 此处只关闭仍处于连接状态的分支
+		defer func() {
+			for _, branch := range branches {
+				if branch != nil {
+					close(branch)
+				}
+			}
+		}()
+
+		for val := range OrDone(ctx, in) {
+			var blocking []int
+			for i, branch := range branches {
+				if branch == nil {
+					continue
+				}
+
+				switch branchOpts[i].Policy {
+				case Block:
+					blocking = append(blocking, i)
+				case DropOldest:
+					sendDropOldest(branch, val)
+				case DropNewest:
+					select {
+					case branch <- val:
+					default:
+					}
+				case Disconnect:
+					select {
+					case branch <- val:
+					default:
+						close(branch)
+						branches[i] = nil
+					}
+				}
+			}
+
+			if !sendAll(ctx, branches, blocking, val) {
+				return
+			}
+		}
+	}()
+
+	return outs
+}
+
+// sendDropOldest 向branch中写入val 若branch已满 则丢弃其中最旧的值后重试
+func sendDropOldest[T any](branch chan T, val T) {
+	for {
+		select {
+		case branch <- val:
+			return
+		default:
+		}
+
+		select {
+		case <-branch:
+		default:
+			// 缓冲区为0或读取者恰好取走了值 此时无法腾出空间 直接丢弃当前值
+			if cap(branch) == 0 {
+				return
+			}
+		}
+	}
+}
+
+// sendAll 将val写入branches中下标为indexes的所有分支 各分支的写入顺序不固定
+// 全部写入成功时返回true ctx被取消时返回false
+func sendAll[T any](ctx context.Context, branches []chan T, indexes []int, val T) bool {
+	if len(indexes) == 0 {
+		return true
+	}
+
+	// 第0个case为ctx.Done() 其余case与indexes一一对应
+	cases := make([]reflect.SelectCase, len(indexes)+1)
+	cases[0] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}
+	for i, index := range indexes {
+		cases[i+1] = reflect.SelectCase{
+			Dir:  reflect.SelectSend,
+			Chan: reflect.ValueOf(branches[index]),
+			Send: reflect.ValueOf(&val).Elem(),
+		}
+	}
+
+	for remaining := len(indexes); remaining > 0; remaining-- {
+		chosen, _, _ := reflect.Select(cases)
+		if chosen == 0 {
+			return false
+		}
+
+		// 与Tee中将out置为nil的做法相同 零值的Chan会使该case永远不会被选中
+		cases[chosen].Chan = reflect.Value{}
+	}
+
+	return true
+}
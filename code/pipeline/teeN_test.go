@@ -0,0 +1,150 @@
+package pipeline
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// sliceStream 将values依次写入一个已关闭的带缓冲channel
+func sliceStream(values ...int) <-chan int {
+	stream := make(chan int, len(values))
+	for _, v := range values {
+		stream <- v
+	}
+	close(stream)
+	return stream
+}
+
+func drain(c <-chan int) []int {
+	var got []int
+	for v := range c {
+		got = append(got, v)
+	}
+	return got
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTeeN_BlockingBranchesReceiveAllValues(t *testing.T) {
+	outs := TeeN(context.Background(), sliceStream(1, 2, 3), 3)
+
+	// 以与分支顺序相反的顺序读取 阻塞的分支不能要求按固定顺序读取
+	results := make([][]int, len(outs))
+	for i := 0; i < 3; i++ {
+		for j := len(outs) - 1; j >= 0; j-- {
+			results[j] = append(results[j], <-outs[j])
+		}
+	}
+
+	for i, got := range results {
+		if expected := []int{1, 2, 3}; !equalInts(got, expected) {
+			t.Errorf("branch %v: expected %v, but received %v", i, expected, got)
+		}
+	}
+}
+
+func TestTeeN_DropNewestKeepsOldestValues(t *testing.T) {
+	outs := TeeN(context.Background(), sliceStream(1, 2, 3, 4, 5), 2,
+		BranchOptions{},
+		BranchOptions{BufferSize: 2, Policy: DropNewest},
+	)
+
+	// 先读完阻塞分支 此时慢分支中只保留了最先写入的2个值
+	if got := drain(outs[0]); !equalInts(got, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("blocking branch: received %v", got)
+	}
+	if got := drain(outs[1]); !equalInts(got, []int{1, 2}) {
+		t.Errorf("drop newest branch: expected [1 2], but received %v", got)
+	}
+}
+
+func TestTeeN_DropOldestKeepsNewestValues(t *testing.T) {
+	outs := TeeN(context.Background(), sliceStream(1, 2, 3, 4, 5), 2,
+		BranchOptions{},
+		BranchOptions{BufferSize: 2, Policy: DropOldest},
+	)
+
+	if got := drain(outs[0]); !equalInts(got, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("blocking branch: received %v", got)
+	}
+	if got := drain(outs[1]); !equalInts(got, []int{4, 5}) {
+		t.Errorf("drop oldest branch: expected [4 5], but received %v", got)
+	}
+}
+
+func TestTeeN_DisconnectClosesSlowBranch(t *testing.T) {
+	outs := TeeN(context.Background(), sliceStream(1, 2, 3, 4, 5), 2,
+		BranchOptions{},
+		BranchOptions{BufferSize: 1, Policy: Disconnect},
+	)
+
+	if got := drain(outs[0]); !equalInts(got, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("blocking branch: received %v", got)
+	}
+	// 缓冲区只能容纳第1个值 写入第2个值时该分支被断开
+	if got := drain(outs[1]); !equalInts(got, []int{1}) {
+		t.Errorf("disconnected branch: expected [1], but received %v", got)
+	}
+}
+
+func TestTeeN_SlowBranchDoesNotStallFastBranch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	outs := TeeN(ctx, Take(ctx, Repeat(ctx, 1), 100), 2,
+		BranchOptions{},
+		BranchOptions{BufferSize: 1, Policy: DropNewest},
+	)
+
+	count := 0
+	for range outs[0] {
+		count++
+	}
+	if count != 100 {
+		t.Errorf("expected fast branch to receive 100 values, but received %v", count)
+	}
+}
+
+func TestTeeN_StopsOnCancel(t *testing.T) {
+	base := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	outs := TeeN(ctx, Repeat(ctx, 1), 3,
+		BranchOptions{},
+		BranchOptions{BufferSize: 4, Policy: DropOldest},
+		BranchOptions{BufferSize: 4, Policy: Disconnect},
+	)
+	<-outs[0]
+	cancel()
+
+	for _, out := range outs {
+		select {
+		case <-time.After(time.Second):
+			t.Fatal("test timed out")
+		case <-drainAsync(out):
+		}
+	}
+	waitGoroutines(t, base)
+}
+
+func drainAsync(c <-chan int) <-chan struct{} {
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for range c {
+		}
+	}()
+	return finished
+}
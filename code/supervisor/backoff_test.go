@@ -0,0 +1,95 @@
+package supervisor
+
+import (
+	"code/backoff"
+	"code/clock"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// recordingSilentWard 返回一个从不发送心跳的ward 每次启动时将启动时刻写入starts
+func recordingSilentWard(clk clock.Clock, starts chan<- time.Time) StartGoroutineFn {
+	return func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
+		starts <- clk.Now()
+		return make(chan interface{})
+	}
+}
+
+func TestSupervisor_RestartSequenceFollowsBackoff(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	done := make(chan interface{})
+	defer close(done)
+
+	const timeout = time.Second
+	starts := make(chan time.Time, 10)
+	NewSupervisor(Config{
+		MaxRestarts: 10,
+		Window:      time.Hour,
+		Children:    []ChildSpec{{Name: "silent", Start: recordingSilentWard(clk, starts), Timeout: timeout}},
+		Backoff:     &backoff.Policy{Initial: time.Second, Multiplier: 2, Max: 4 * time.Second},
+		Clock:       clk,
+	}).Start(done, time.Hour)
+
+	if started := <-starts; !started.Equal(epoch) {
+		t.Fatalf("expected first start at %v, but started at %v", epoch, started)
+	}
+
+	// 每次重启都要先等待1s的心跳超时 再等待退避时长
+	expectedDelays := []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+	last := epoch
+	for i, delay := range expectedDelays {
+		// 此时有2个定时器: Supervisor自身的pulse以及监控ward心跳的定时器
+		clk.BlockUntil(2)
+		clk.Advance(timeout)
+
+		// 心跳超时后 监控心跳的定时器被替换为退避的定时器
+		clk.BlockUntil(2)
+		clk.Advance(delay - time.Millisecond)
+		select {
+		case started := <-starts:
+			t.Fatalf("restart %v: ward restarted too early at %v", i, started.Sub(epoch))
+		default:
+		}
+
+		clk.Advance(time.Millisecond)
+		select {
+		case started := <-starts:
+			if expected := last.Add(timeout + delay); !started.Equal(expected) {
+				t.Errorf("restart %v: expected start at %v, but started at %v", i, expected.Sub(epoch), started.Sub(epoch))
+			}
+			last = started
+		case <-time.After(time.Second):
+			t.Fatalf("restart %v: ward was not restarted", i)
+		}
+	}
+}
+
+func TestSupervisor_RestartDelayResetsAfterHealthyPeriod(t *testing.T) {
+	s := NewSupervisor(Config{
+		Backoff:    &backoff.Policy{Initial: time.Second, Multiplier: 2},
+		ResetAfter: time.Minute,
+	})
+	c := &child{backoff: backoff.New(*s.config.Backoff, nil), startedAt: epoch}
+
+	// 短时间内连续故障 退避时长持续增长
+	if d := s.restartDelay(c, epoch.Add(time.Second)); d != time.Second {
+		t.Errorf("expected %v, but received %v", time.Second, d)
+	}
+	if d := s.restartDelay(c, epoch.Add(2*time.Second)); d != 2*time.Second {
+		t.Errorf("expected %v, but received %v", 2*time.Second, d)
+	}
+
+	// 运行超过ResetAfter后才出现故障 退避时长回到初始值
+	if d := s.restartDelay(c, epoch.Add(time.Minute)); d != time.Second {
+		t.Errorf("expected backoff to reset to %v, but received %v", time.Second, d)
+	}
+}
+
+func TestSupervisor_NoBackoffRestartsImmediately(t *testing.T) {
+	s := NewSupervisor(Config{})
+	if d := s.restartDelay(&child{}, epoch); d != 0 {
+		t.Errorf("expected no delay, but received %v", d)
+	}
+}
@@ -0,0 +1,151 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrStaleCheckpoint 已被停止(并由新实例替代)的ward尝试提交检查点时返回该错误
+var ErrStaleCheckpoint = errors.New("supervisor: checkpoint committed by a stopped ward")
+
+// CheckpointStore 保存每个ward最后一次提交的检查点 ward为ward的名称
+type CheckpointStore[C any] interface {
+	// Load 读取ward的检查点 ward从未提交过检查点时ok为false
+	Load(ward string) (checkpoint C, ok bool, err error)
+	Save(ward string, checkpoint C) error
+}
+
+// ResumableStartFn 与StartGoroutineFn相同 但额外接收上一个实例提交的最后一个检查点
+// ward通过commit提交自己的进度 重启后的新实例将从该进度继续 而非从头开始
+//
+// 提交的时机决定了经由bridge传递的值的语义:
+// 将值写入输出channel之后立即提交 则每个值至少被传递一次
+// Supervisor可能在写入与提交之间重启ward(例如错过了心跳) 此时旧实例的提交返回ErrStaleCheckpoint 新实例会再次写入该值
+// 因此下游需要能够容忍重复的值 若在写入之前提交 则ward在写入前崩溃时该值会丢失 即至多一次
+type ResumableStartFn[C any] func(done <-chan interface{}, pulseInterval time.Duration, checkpoint C, commit func(C) error) (heartbeat <-chan interface{})
+
+// WithCheckpoint 将ResumableStartFn转换为StartGoroutineFn 以便交给Supervisor监控
+// 每次启动ward时 从store中读取名为ward的检查点并传给新实例 从未提交过检查点时新实例从零值开始
+// 读取失败时(例如FileStore的文件已损坏) 不启动新实例 而是在心跳channel中发送包含该错误的Exit后将其关闭
+// Supervisor因此认为ward启动失败 在HeartbeatMissed事件的Reason中报告该错误 并按重启策略重试
+// 重试次数超过上限时放弃并向上升级 而非从零值开始重放所有的值
+// 新实例启动后 旧实例的commit将返回ErrStaleCheckpoint 防止被替代的实例覆盖新实例的进度
+func WithCheckpoint[C any](ward string, store CheckpointStore[C], start ResumableStartFn[C]) StartGoroutineFn {
+	var mu sync.Mutex
+	generation := 0
+
+	return func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
+		mu.Lock()
+		generation++
+		current := generation
+		mu.Unlock()
+
+		commit := func(checkpoint C) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if current != generation {
+				return ErrStaleCheckpoint
+			}
+			return store.Save(ward, checkpoint)
+		}
+
+		checkpoint, _, err := store.Load(ward)
+		if err != nil {
+			heartbeat := make(chan interface{}, 1)
+			heartbeat <- Exit{Err: fmt.Errorf("cannot load checkpoint of %s: %w", ward, err)}
+			close(heartbeat)
+			return heartbeat
+		}
+		return start(done, pulseInterval, checkpoint, commit)
+	}
+}
+
+// MemoryStore 将检查点保存在内存中的CheckpointStore 进程退出后检查点丢失
+type MemoryStore[C any] struct {
+	mu          sync.Mutex
+	checkpoints map[string]C
+}
+
+func NewMemoryStore[C any]() *MemoryStore[C] {
+	return &MemoryStore[C]{checkpoints: make(map[string]C)}
+}
+
+func (s *MemoryStore[C]) Load(ward string) (C, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint, ok := s.checkpoints[ward]
+	return checkpoint, ok, nil
+}
+
+func (s *MemoryStore[C]) Save(ward string, checkpoint C) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoints[ward] = checkpoint
+	return nil
+}
+
+// FileStore 将每个ward的检查点以JSON格式保存在dir下的单独文件中 进程重启后仍可读取
+type FileStore[C any] struct {
+	dir string
+}
+
+func NewFileStore[C any](dir string) (*FileStore[C], error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore[C]{dir: dir}, nil
+}
+
+func (s *FileStore[C]) Load(ward string) (C, bool, error) {
+	var checkpoint C
+
+	data, err := os.ReadFile(s.path(ward))
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, false, nil
+	} else if err != nil {
+		return checkpoint, false, err
+	}
+
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, false, err
+	}
+	return checkpoint, true, nil
+}
+
+// Save 先写入临时文件再重命名 保证读取到的检查点总是完整的
+func (s *FileStore[C]) Save(ward string, checkpoint C) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".checkpoint-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(ward))
+}
+
+// path 返回ward对应的文件路径 对ward进行转义 避免其中的路径分隔符
+func (s *FileStore[C]) path(ward string) string {
+	return filepath.Join(s.dir, url.PathEscape(ward)+".json")
+}
@@ -0,0 +1,245 @@
+package supervisor
+
+import (
+	"code/pipeline"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resumableIntWard 返回一个依次输出intList中值的ward 检查点为下一个要输出的值的下标
+// 第一个实例在输出crashAfter个值后退出 模拟ward崩溃
+func resumableIntWard(intChanStream chan<- (<-chan int), intList []int, crashAfter int) ResumableStartFn[int] {
+	instances := 0
+
+	return func(done <-chan interface{}, pulseInterval time.Duration, next int, commit func(int) error) <-chan interface{} {
+		instances++
+		crash := instances == 1
+		heartbeat := make(chan interface{})
+		intStream := make(chan int)
+
+		go func() {
+			defer close(intStream)
+			select {
+			case intChanStream <- intStream:
+			case <-done:
+				return
+			}
+
+			pulse := time.NewTicker(pulseInterval)
+			defer pulse.Stop()
+
+			for i := next; i < len(intList); i++ {
+				if crash && i == crashAfter {
+					close(heartbeat)
+					return
+				}
+
+				for sent := false; !sent; {
+					select {
+					case <-pulse.C:
+						sendPulse(heartbeat)
+					case intStream <- intList[i]:
+						sent = true
+					case <-done:
+						return
+					}
+				}
+
+				// 写入成功后立即提交 重启后从下一个值继续
+				if err := commit(i + 1); err != nil {
+					return
+				}
+			}
+		}()
+
+		return heartbeat
+	}
+}
+
+func TestWithCheckpoint_RestartedWardResumes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan interface{})
+	defer close(done)
+
+	intList := []int{1, 2, 3, 4, 5}
+	intChanStream := make(chan (<-chan int))
+	resultIntStream := pipeline.Bridge(ctx, intChanStream)
+
+	store := NewMemoryStore[int]()
+	NewSupervisor(Config{
+		MaxRestarts: 5,
+		Window:      time.Minute,
+		Children: []ChildSpec{{
+			Name:    "ints",
+			Start:   WithCheckpoint("ints", store, resumableIntWard(intChanStream, intList, 2)),
+			Timeout: testTimeout,
+		}},
+	}).Start(done, time.Hour)
+
+	for i, expected := range intList {
+		select {
+		case v := <-resultIntStream:
+			if v != expected {
+				t.Fatalf("index %v: expected %v, but received %v", i, expected, v)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("test timed out")
+		}
+	}
+
+	select {
+	case v := <-resultIntStream:
+		t.Errorf("expected no more values, but received %v", v)
+	case <-time.After(2 * testTimeout):
+	}
+
+	if checkpoint, ok, _ := store.Load("ints"); !ok || checkpoint != len(intList) {
+		t.Errorf("expected checkpoint %v, but got %v", len(intList), checkpoint)
+	}
+}
+
+func TestWithCheckpoint_StaleWardCannotCommit(t *testing.T) {
+	store := NewMemoryStore[int]()
+
+	var commits []func(int) error
+	start := WithCheckpoint("ward", store, func(done <-chan interface{}, _ time.Duration, _ int, commit func(int) error) <-chan interface{} {
+		commits = append(commits, commit)
+		return nil
+	})
+
+	start(nil, time.Second)
+	start(nil, time.Second)
+
+	if err := commits[1](2); err != nil {
+		t.Fatalf("expected current ward to commit, but received %v", err)
+	}
+	if err := commits[0](1); !errors.Is(err, ErrStaleCheckpoint) {
+		t.Errorf("expected ErrStaleCheckpoint, but received %v", err)
+	}
+	if checkpoint, _, _ := store.Load("ward"); checkpoint != 2 {
+		t.Errorf("expected checkpoint 2, but got %v", checkpoint)
+	}
+}
+
+func TestWithCheckpoint_CorruptCheckpointFailsStart(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore[int](dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(store.path("ints"), []byte("{corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	starts := 0
+	s := NewSupervisor(Config{
+		MaxRestarts: 1,
+		Window:      time.Minute,
+		Children: []ChildSpec{{
+			Name: "ints",
+			Start: WithCheckpoint("ints", store, func(done <-chan interface{}, _ time.Duration, _ int, _ func(int) error) <-chan interface{} {
+				starts++
+				return nil
+			}),
+			Timeout: testTimeout,
+		}},
+	})
+	events, cancel := s.Subscribe(10)
+	defer cancel()
+
+	done := make(chan interface{})
+	defer close(done)
+	for range s.Start(done, time.Hour) {
+	}
+
+	// 检查点无法读取时ward从未启动 Supervisor重试后放弃 而非从零值开始
+	if starts != 0 {
+		t.Errorf("expected ward not to start, but started %v times", starts)
+	}
+	gaveUp := false
+	for len(events) > 0 {
+		if event := <-events; event.Kind == WardGaveUp {
+			gaveUp = true
+		}
+	}
+	if !gaveUp {
+		t.Errorf("expected supervisor to give up")
+	}
+}
+
+func TestWithCheckpoint_LoadErrorIsReported(t *testing.T) {
+	store, err := NewFileStore[int](t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(store.path("ints"), []byte("{corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSupervisor(Config{
+		MaxRestarts: 0,
+		Window:      time.Minute,
+		Children: []ChildSpec{{
+			Name: "ints",
+			Start: WithCheckpoint("ints", store, func(done <-chan interface{}, _ time.Duration, _ int, _ func(int) error) <-chan interface{} {
+				return nil
+			}),
+			Timeout: testTimeout,
+		}},
+	})
+	events, cancel := s.Subscribe(10)
+	defer cancel()
+
+	done := make(chan interface{})
+	defer close(done)
+	for range s.Start(done, time.Hour) {
+	}
+
+	// 操作者可以从事件中看到检查点读取失败的原因
+	for len(events) > 0 {
+		if event := <-events; event.Kind == HeartbeatMissed {
+			if !strings.Contains(event.Reason, "cannot load checkpoint of ints") {
+				t.Errorf("expected the load error in the reason, but received %q", event.Reason)
+			}
+			return
+		}
+	}
+	t.Error("expected a HeartbeatMissed event")
+}
+
+func TestFileStore_PersistsAcrossInstances(t *testing.T) {
+	type progress struct {
+		Offset int
+		Last   string
+	}
+
+	dir := t.TempDir()
+	store, err := NewFileStore[progress](dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, err := store.Load("a/b"); ok || err != nil {
+		t.Fatalf("expected no checkpoint, but received ok=%v err=%v", ok, err)
+	}
+	if err := store.Save("a/b", progress{Offset: 3, Last: "c"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileStore[progress](dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint, ok, err := reopened.Load("a/b")
+	if err != nil || !ok {
+		t.Fatalf("expected checkpoint, but received ok=%v err=%v", ok, err)
+	}
+	if checkpoint != (progress{Offset: 3, Last: "c"}) {
+		t.Errorf("unexpected checkpoint %+v", checkpoint)
+	}
+}
@@ -0,0 +1,95 @@
+package supervisor
+
+import (
+	"sync"
+	"time"
+)
+
+// EventKind 子goroutine(ward)生命周期事件的类型
+type EventKind int
+
+const (
+	// WardStarted ward第一次被启动
+	WardStarted EventKind = iota
+	// HeartbeatMissed 超时未收到ward的心跳 或ward的心跳channel被关闭
+	HeartbeatMissed
+	// WardRestarted ward被重启 可能是ward自身出现了故障 也可能是因为重启策略而随其他ward一起重启
+	WardRestarted
+	// WardGaveUp 重启次数超过上限 Supervisor放弃重启并退出
+	WardGaveUp
+	// WardStopped Supervisor退出时停止了ward
+	WardStopped
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case WardStarted:
+		return "WardStarted"
+	case HeartbeatMissed:
+		return "HeartbeatMissed"
+	case WardRestarted:
+		return "WardRestarted"
+	case WardGaveUp:
+		return "WardGaveUp"
+	case WardStopped:
+		return "WardStopped"
+	default:
+		return "Unknown"
+	}
+}
+
+// Event 一个ward生命周期事件
+type Event struct {
+	Kind          EventKind
+	Ward          string    // ward的名称 即ChildSpec.Name
+	Time          time.Time // 事件发生的时刻
+	RestartCount  int       // 截至该事件 ward被重启的总次数
+	LastHeartbeat time.Time // 最后一次收到ward心跳的时刻 从未收到过心跳时为ward的启动时刻
+	Reason        string
+}
+
+// eventHub 将事件广播给所有订阅者
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// Subscribe 订阅Supervisor的事件 buffer为返回的channel的缓冲区大小
+// 为了不阻塞监控逻辑 订阅者的缓冲区已满时新的事件会被丢弃 因此订阅者应及时读取或设置足够大的缓冲区
+// 调用返回的cancel函数取消订阅 并关闭返回的channel
+func (s *Supervisor) Subscribe(buffer int) (events <-chan Event, cancel func()) {
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+
+	if s.events.subscribers == nil {
+		s.events.subscribers = make(map[chan Event]struct{})
+	}
+
+	c := make(chan Event, buffer)
+	s.events.subscribers[c] = struct{}{}
+
+	var once sync.Once
+	cancel = func() {
+		once.Do(func() {
+			s.events.mu.Lock()
+			defer s.events.mu.Unlock()
+			delete(s.events.subscribers, c)
+			close(c)
+		})
+	}
+
+	return c, cancel
+}
+
+// publish 将event非阻塞地发送给所有订阅者
+func (h *eventHub) publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.subscribers {
+		select {
+		case c <- event:
+		default:
+		}
+	}
+}
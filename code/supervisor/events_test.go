@@ -0,0 +1,131 @@
+package supervisor
+
+import (
+	"code/clock"
+	"testing"
+	"time"
+)
+
+func TestSupervisor_PublishesLifecycleEvents(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	var starts int32
+	s := NewSupervisor(Config{
+		MaxRestarts: 1,
+		Window:      time.Minute,
+		Children:    []ChildSpec{{Name: "crashing", Start: crashingWard(&starts, 100), Timeout: testTimeout}},
+	})
+	events, cancel := s.Subscribe(10)
+	defer cancel()
+
+	heartbeat := s.Start(done, time.Hour)
+	for range heartbeat {
+	}
+
+	expected := []struct {
+		kind         EventKind
+		restartCount int
+	}{
+		{WardStarted, 0},
+		{HeartbeatMissed, 0},
+		{WardRestarted, 1},
+		{HeartbeatMissed, 1},
+		{WardGaveUp, 1},
+		{WardStopped, 1},
+	}
+	for i, e := range expected {
+		select {
+		case event := <-events:
+			if event.Kind != e.kind || event.RestartCount != e.restartCount || event.Ward != "crashing" {
+				t.Errorf("event %v: expected %v with restart count %v, but received %+v", i, e.kind, e.restartCount, event)
+			}
+			if event.Kind == HeartbeatMissed && event.Reason != "ward exited" {
+				t.Errorf("event %v: expected reason %q, but received %q", i, "ward exited", event.Reason)
+			}
+		default:
+			t.Fatalf("event %v: expected %v, but received nothing", i, e.kind)
+		}
+	}
+}
+
+func TestSupervisor_EventCarriesHeartbeatTiming(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	done := make(chan interface{})
+	defer close(done)
+
+	const timeout = time.Second
+	s := NewSupervisor(Config{
+		MaxRestarts: 10,
+		Window:      time.Hour,
+		Children:    []ChildSpec{{Name: "silent", Start: silentWard(new(int32)), Timeout: timeout}},
+		Clock:       clk,
+	})
+	events, cancel := s.Subscribe(10)
+	defer cancel()
+	s.Start(done, time.Hour)
+
+	if event := <-events; event.Kind != WardStarted {
+		t.Fatalf("expected WardStarted, but received %v", event.Kind)
+	}
+
+	clk.BlockUntil(2)
+	clk.Advance(timeout)
+
+	missed := <-events
+	if missed.Kind != HeartbeatMissed || missed.Reason != "heartbeat missed" {
+		t.Fatalf("expected HeartbeatMissed, but received %+v", missed)
+	}
+	if !missed.Time.Equal(epoch.Add(timeout)) || !missed.LastHeartbeat.Equal(epoch) {
+		t.Errorf("expected event at %v with last heartbeat %v, but received %+v", epoch.Add(timeout), epoch, missed)
+	}
+
+	restarted := <-events
+	if restarted.Kind != WardRestarted || restarted.RestartCount != 1 || restarted.Reason != "heartbeat missed" {
+		t.Errorf("expected WardRestarted with restart count 1, but received %+v", restarted)
+	}
+}
+
+func TestSupervisor_OneForAllEventNamesFailedSibling(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	var healthyStarts, crashingStarts int32
+	s := NewSupervisor(Config{
+		Strategy:    OneForAll,
+		MaxRestarts: 5,
+		Window:      time.Second,
+		Children: []ChildSpec{
+			{Name: "healthy", Start: healthyWard(&healthyStarts), Timeout: testTimeout},
+			{Name: "crashing", Start: crashingWard(&crashingStarts, 1), Timeout: testTimeout},
+		},
+	})
+	events, cancel := s.Subscribe(10)
+	defer cancel()
+	s.Start(done, time.Hour)
+
+	for {
+		select {
+		case event := <-events:
+			if event.Kind == WardRestarted && event.Ward == "healthy" {
+				if expected := "crashing failed: ward exited"; event.Reason != expected {
+					t.Errorf("expected reason %q, but received %q", expected, event.Reason)
+				}
+				return
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("test timed out")
+		}
+	}
+}
+
+func TestSupervisor_CancelSubscriptionClosesChannel(t *testing.T) {
+	s := NewSupervisor(Config{})
+	events, cancel := s.Subscribe(1)
+	cancel()
+	cancel()
+
+	if _, ok := <-events; ok {
+		t.Error("expected closed channel after cancel")
+	}
+}
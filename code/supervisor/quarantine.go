@@ -0,0 +1,318 @@
+package supervisor
+
+import (
+	"code/clock"
+	"context"
+	"sync"
+	"time"
+)
+
+// ItemStartFn 与StartGoroutineFn相同 但ward从items中读取要处理的值
+// ward处理完一个值后应调用ack 从items中读取下一个值时也视为确认了上一个值
+// 及时调用ack可以避免ward在两个值之间崩溃时 错误地将崩溃归咎于上一个值
+type ItemStartFn[T any] func(done <-chan interface{}, pulseInterval time.Duration, items <-chan T, ack func()) (heartbeat <-chan interface{})
+
+// Failure 一次ward在处理某个值期间被重启的记录
+type Failure struct {
+	DeliveredAt time.Time // 该值被交给ward的时刻
+	FailedAt    time.Time // ward被重启的时刻
+}
+
+// DeadLetter 连续导致ward崩溃次数达到上限而被隔离的值 以及它的故障历史
+type DeadLetter[T any] struct {
+	Item     T
+	Failures []Failure
+}
+
+// suspect 一个已从输入中取出但尚未被确认的值
+type suspect[T any] struct {
+	item        T
+	deliveredAt time.Time
+	failures    []Failure
+	owner       int // 持有该值的feed对应的ward实例 为0表示该值在pending中
+}
+
+// Quarantine 在ward与输入之间隔离有毒消息
+// Quarantine记录每个ward实例正在处理(已交付但未确认)的值 若ward在确认之前自身崩溃 即退出或漏掉心跳 则认为该值导致了崩溃
+// 该值会被优先重新交给新的ward实例 连续导致崩溃maxCrashes次后 被移入DeadLetters 新实例继续处理下一个值
+// 在OneForAll或RestForOne策略下因其他子goroutine的故障而被重启时 ward正在处理的值被放回 但不归咎于它
+// Quarantine以clock判断ward是否漏掉了心跳 因此应与Supervisor使用同一个Clock
+type Quarantine[T any] struct {
+	in          <-chan T
+	maxCrashes  int
+	clock       clock.Clock
+	deadLetters chan DeadLetter[T]
+
+	mu         sync.Mutex
+	generation int           // 当前ward实例是第几次启动
+	current    *suspect[T]   // 当前ward实例已收到但尚未确认的值
+	offered    *suspect[T]   // 正在交给ward实例 但还不确定其是否已收到的值 交付结束时置为nil并通知changed
+	pending    []*suspect[T] // 等待交给ward的值 曾导致崩溃的值排在最前
+	dead       []DeadLetter[T]
+	inClosed   bool
+	liveFeeds  int           // 尚未退出的feed数量 旧实例的feed退出前 新实例的feed不会取值 以保证值的顺序
+	watching   int           // 尚未得出结论的watch数量
+	crashed    bool          // 当前ward实例是否因自身的故障而退出
+	changed    chan struct{} // pending或dead发生变化时关闭并重建 用于唤醒等待中的goroutine
+}
+
+// NewQuarantine 从in中读取值交给ward 同一个值连续导致ward崩溃maxCrashes次后将其隔离
+// ctx被取消后不再向DeadLetters写入 clk为nil时使用clock.Real
+func NewQuarantine[T any](ctx context.Context, in <-chan T, maxCrashes int, clk clock.Clock) *Quarantine[T] {
+	if maxCrashes < 1 {
+		maxCrashes = 1
+	}
+
+	q := &Quarantine[T]{
+		in:          in,
+		maxCrashes:  maxCrashes,
+		clock:       clock.OrReal(clk),
+		deadLetters: make(chan DeadLetter[T]),
+		changed:     make(chan struct{}),
+	}
+	go q.forwardDeadLetters(ctx)
+	return q
+}
+
+// DeadLetters 返回被隔离的值 被隔离的值在读取前暂存在Quarantine中 不会阻塞ward处理后续的值
+func (q *Quarantine[T]) DeadLetters() <-chan DeadLetter[T] {
+	return q.deadLetters
+}
+
+// Wrap 将ItemStartFn转换为StartGoroutineFn 以便交给Supervisor监控
+// 与Supervisor相同 启动新实例前需要关闭旧实例的done 否则Wrap将一直等待旧实例结束正在进行的交付
+func (q *Quarantine[T]) Wrap(start ItemStartFn[T]) StartGoroutineFn {
+	return func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
+		q.mu.Lock()
+		// 旧实例的feed可能正在交付一个值 等待其结束交付 以确定旧实例是否收到了该值
+		// 同时等待旧实例的watch判断旧实例是否因自身的故障而退出
+		// 旧实例的done已被关闭 因此feed要么完成交付 要么放弃交付 watch也会立即得出结论 不会一直等待
+		for q.offered != nil || q.watching > 0 {
+			changed := q.changed
+			q.mu.Unlock()
+			<-changed
+			q.mu.Lock()
+		}
+
+		q.generation++
+		generation := q.generation
+
+		// 上一个实例在确认前崩溃 它已收到但未确认的值即为嫌疑值
+		// 上一个实例未收到任何值就崩溃时(例如启动时依赖不可用) 不归咎于任何值
+		// 上一个实例因其他子goroutine的故障被重启时 将该值放回pending 也不归咎于它
+		s := q.current
+		crashed := q.crashed
+		q.current = nil
+		q.crashed = false
+
+		if s != nil && !crashed {
+			s.owner = 0
+			q.requeueLocked(s)
+		} else if s != nil {
+			s.owner = 0
+			s.failures = append(s.failures, Failure{DeliveredAt: s.deliveredAt, FailedAt: q.clock.Now()})
+			if len(s.failures) >= q.maxCrashes {
+				q.dead = append(q.dead, DeadLetter[T]{Item: s.item, Failures: s.failures})
+				q.notifyLocked()
+			} else {
+				q.requeueLocked(s)
+			}
+		}
+		q.liveFeeds++
+		q.watching++
+		q.mu.Unlock()
+
+		items := make(chan T)
+		ack := func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			if generation == q.generation {
+				q.current = nil
+			}
+		}
+
+		go q.feed(done, generation, items)
+		heartbeat := make(chan interface{})
+		go q.watch(done, generation, pulseInterval, start(done, pulseInterval, items, ack), heartbeat)
+		return heartbeat
+	}
+}
+
+// watch 将第generation个ward实例的心跳转发给out 并判断该实例是否因自身的故障而退出
+// done被关闭前心跳被关闭 即ward自己退出了 done被关闭时心跳已超过2个pulseInterval未到达 即ward漏掉了心跳
+// Supervisor以pulseInterval的2倍作为心跳超时 其他情况下done被关闭是因为其他子goroutine的故障 或Supervisor退出
+func (q *Quarantine[T]) watch(done <-chan interface{}, generation int, pulseInterval time.Duration, heartbeat <-chan interface{}, out chan interface{}) {
+	crashed := false
+	defer func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if crashed && generation == q.generation {
+			q.crashed = true
+		}
+		q.watching--
+		q.notifyLocked()
+	}()
+
+	lastPulse := q.clock.Now()
+	for {
+		select {
+		case <-done:
+			crashed = q.clock.Since(lastPulse) >= 2*pulseInterval
+			return
+		case pulse, ok := <-heartbeat:
+			if !ok {
+				select {
+				case <-done:
+				default:
+					crashed = true
+				}
+				close(out)
+				return
+			}
+
+			lastPulse = q.clock.Now()
+			select {
+			case out <- pulse:
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
+// forwardDeadLetters 按被隔离的顺序将值写入DeadLetters
+func (q *Quarantine[T]) forwardDeadLetters(ctx context.Context) {
+	defer close(q.deadLetters)
+
+	for {
+		q.mu.Lock()
+		var deadLetters chan DeadLetter[T]
+		var dead DeadLetter[T]
+		if len(q.dead) > 0 {
+			deadLetters, dead = q.deadLetters, q.dead[0]
+		}
+		changed := q.changed
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		case deadLetters <- dead:
+			q.mu.Lock()
+			q.dead = q.dead[1:]
+			q.mu.Unlock()
+		}
+	}
+}
+
+// feed 将值交给第generation个ward实例
+func (q *Quarantine[T]) feed(done <-chan interface{}, generation int, items chan T) {
+	var next *suspect[T]
+	// 退出时尚未交付的值放回pending 交给下一个ward实例
+	defer func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.releaseLocked(next, generation)
+		q.liveFeeds--
+		q.notifyLocked()
+	}()
+
+	itemsClosed := false
+	for {
+		q.mu.Lock()
+		if next != nil && next.owner != generation {
+			// 该值已被Wrap认定为嫌疑值并接管
+			next = nil
+		}
+		// 旧实例的feed仍持有或可能读取值时不取值
+		exclusive := q.liveFeeds == 1
+		if next == nil && exclusive && len(q.pending) > 0 {
+			next = q.pending[0]
+			next.owner = generation
+			q.pending = q.pending[1:]
+		}
+
+		var in <-chan T
+		var itemStream chan T
+		var item T
+		switch {
+		case next != nil && !itemsClosed:
+			itemStream, item = items, next.item
+			if generation == q.generation && q.offered != next {
+				next.deliveredAt = q.clock.Now()
+				q.offered = next
+			}
+		case next == nil && !exclusive:
+		case next == nil && !q.inClosed:
+			in = q.in
+		case next == nil && !itemsClosed && len(q.pending) == 0:
+			// 输入已经读完 通知ward没有更多的值了
+			close(items)
+			itemsClosed = true
+		}
+		changed := q.changed
+		q.mu.Unlock()
+
+		select {
+		case <-done:
+			return
+		case <-changed:
+		case value, ok := <-in:
+			if !ok {
+				q.mu.Lock()
+				q.inClosed = true
+				q.notifyLocked()
+				q.mu.Unlock()
+				continue
+			}
+			next = &suspect[T]{item: value, owner: generation}
+		case itemStream <- item:
+			q.mu.Lock()
+			if q.offered == next {
+				q.offered = nil
+				q.notifyLocked()
+			}
+			if next.owner == generation && generation == q.generation {
+				q.current = next
+			} else {
+				// 交给了已被替代的实例 视为未曾交付 放回pending
+				q.releaseLocked(next, generation)
+			}
+			q.mu.Unlock()
+			next = nil
+		}
+	}
+}
+
+// releaseLocked 若s仍由第generation个ward实例的feed持有 则将其放回pending
+func (q *Quarantine[T]) releaseLocked(s *suspect[T], generation int) {
+	if s == nil || s.owner != generation {
+		return
+	}
+	if q.offered == s {
+		q.offered = nil
+	}
+	s.owner = 0
+	q.requeueLocked(s)
+}
+
+// requeueLocked 将s放回pending 曾导致崩溃的值排在最前 其余的值排在曾导致崩溃的值之后 保持原有顺序
+func (q *Quarantine[T]) requeueLocked(s *suspect[T]) {
+	i := 0
+	if len(s.failures) == 0 {
+		for i < len(q.pending) && len(q.pending[i].failures) > 0 {
+			i++
+		}
+	}
+
+	q.pending = append(q.pending, nil)
+	copy(q.pending[i+1:], q.pending[i:])
+	q.pending[i] = s
+	q.notifyLocked()
+}
+
+func (q *Quarantine[T]) notifyLocked() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
@@ -0,0 +1,296 @@
+package supervisor
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// negativeCrashingWard 与第5章27-statefulComplicatedWard中的ward相同 遇到负数时直接返回(此处同时关闭心跳)
+// 处理成功的值写入results
+func negativeCrashingWard(starts *int32, results chan<- int) ItemStartFn[int] {
+	return func(done <-chan interface{}, pulseInterval time.Duration, items <-chan int, ack func()) <-chan interface{} {
+		atomic.AddInt32(starts, 1)
+		heartbeat := make(chan interface{})
+
+		go func() {
+			pulse := time.NewTicker(pulseInterval)
+			defer pulse.Stop()
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-pulse.C:
+					sendPulse(heartbeat)
+				case intVal, ok := <-items:
+					if !ok {
+						return
+					}
+					if intVal < 0 {
+						close(heartbeat)
+						return
+					}
+
+					select {
+					case results <- intVal:
+						ack()
+					case <-done:
+						return
+					}
+				}
+			}
+		}()
+
+		return heartbeat
+	}
+}
+
+func TestQuarantine_MovesPoisonMessageToDeadLetters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan interface{})
+	defer close(done)
+
+	in := make(chan int, 5)
+	for _, v := range []int{1, 2, -1, 3, 4} {
+		in <- v
+	}
+	close(in)
+
+	var starts int32
+	results := make(chan int)
+	q := NewQuarantine(ctx, in, 3, nil)
+	NewSupervisor(Config{
+		MaxRestarts: 10,
+		Window:      time.Minute,
+		Children:    []ChildSpec{{Name: "ints", Start: q.Wrap(negativeCrashingWard(&starts, results)), Timeout: testTimeout}},
+	}).Start(done, time.Hour)
+
+	var received []int
+	var dead []DeadLetter[int]
+	for len(received) < 4 || len(dead) < 1 {
+		select {
+		case v := <-results:
+			received = append(received, v)
+		case d := <-q.DeadLetters():
+			dead = append(dead, d)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("test timed out with results %v and dead letters %v", received, dead)
+		}
+	}
+
+	if expected := []int{1, 2, 3, 4}; len(received) != len(expected) {
+		t.Fatalf("expected %v, but received %v", expected, received)
+	} else {
+		for i := range expected {
+			if received[i] != expected[i] {
+				t.Errorf("index %v: expected %v, but received %v", i, expected[i], received[i])
+			}
+		}
+	}
+
+	if dead[0].Item != -1 || len(dead[0].Failures) != 3 {
+		t.Errorf("expected -1 with 3 failures, but received %+v", dead[0])
+	}
+	for i, failure := range dead[0].Failures {
+		if failure.FailedAt.Before(failure.DeliveredAt) {
+			t.Errorf("failure %v: failed at %v before delivered at %v", i, failure.FailedAt, failure.DeliveredAt)
+		}
+	}
+
+	// 首次启动 加上-1导致的3次重启
+	if n := atomic.LoadInt32(&starts); n != 4 {
+		t.Errorf("expected ward to be started 4 times, but started %v times", n)
+	}
+}
+
+func TestQuarantine_AckedItemIsNotBlamed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	in := make(chan int, 1)
+	in <- 1
+	q := NewQuarantine(ctx, in, 1, nil)
+
+	// 第一个实例处理并确认了1 之后崩溃 1不应被隔离
+	first := q.Wrap(func(done <-chan interface{}, _ time.Duration, items <-chan int, ack func()) <-chan interface{} {
+		<-items
+		ack()
+		return nil
+	})
+	firstDone := make(chan interface{})
+	first(firstDone, time.Second)
+	close(firstDone)
+
+	received := make(chan int, 1)
+	second := q.Wrap(func(done <-chan interface{}, _ time.Duration, items <-chan int, _ func()) <-chan interface{} {
+		go func() {
+			for v := range items {
+				received <- v
+			}
+		}()
+		return nil
+	})
+	second(make(chan interface{}), time.Second)
+
+	in <- 2
+	select {
+	case v := <-received:
+		if v != 2 {
+			t.Errorf("expected 2, but received %v", v)
+		}
+	case d := <-q.DeadLetters():
+		t.Fatalf("acknowledged item was quarantined: %+v", d)
+	case <-time.After(time.Second):
+		t.Fatal("test timed out")
+	}
+}
+
+func TestQuarantine_StartupCrashIsNotBlamed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan interface{})
+	defer close(done)
+
+	in := make(chan int, 2)
+	in <- 1
+	in <- 2
+	close(in)
+
+	// 前3个实例在启动时就因依赖不可用而崩溃 从未读取items 之后的实例正常处理
+	var starts int32
+	results := make(chan int)
+	healthy := negativeCrashingWard(new(int32), results)
+	ward := func(done <-chan interface{}, pulseInterval time.Duration, items <-chan int, ack func()) <-chan interface{} {
+		if atomic.AddInt32(&starts, 1) <= 3 {
+			// 稍后再崩溃 使feed已经开始交付第一个值
+			heartbeat := make(chan interface{})
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				close(heartbeat)
+			}()
+			return heartbeat
+		}
+		return healthy(done, pulseInterval, items, ack)
+	}
+
+	q := NewQuarantine(ctx, in, 2, nil)
+	NewSupervisor(Config{
+		MaxRestarts: 10,
+		Window:      time.Minute,
+		Children:    []ChildSpec{{Name: "ints", Start: q.Wrap(ward), Timeout: testTimeout}},
+	}).Start(done, time.Hour)
+
+	var received []int
+	for len(received) < 2 {
+		select {
+		case v := <-results:
+			received = append(received, v)
+		case d := <-q.DeadLetters():
+			t.Fatalf("item never received by a ward was quarantined: %+v", d)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("test timed out with results %v", received)
+		}
+	}
+
+	if received[0] != 1 || received[1] != 2 {
+		t.Errorf("expected [1 2], but received %v", received)
+	}
+}
+
+func TestQuarantine_SiblingCrashIsNotBlamed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan interface{})
+	defer close(done)
+
+	in := make(chan int, 1)
+	in <- 1
+	close(in)
+
+	// ints处理每个值需要100ms 期间不确认
+	results := make(chan int)
+	ints := func(done <-chan interface{}, pulseInterval time.Duration, items <-chan int, ack func()) <-chan interface{} {
+		heartbeat := make(chan interface{})
+		go func() {
+			pulse := time.NewTicker(pulseInterval)
+			defer pulse.Stop()
+
+			for item := range items {
+				processed := time.After(100 * time.Millisecond)
+				for processing := true; processing; {
+					select {
+					case <-done:
+						return
+					case <-pulse.C:
+						sendPulse(heartbeat)
+					case <-processed:
+						processing = false
+					}
+				}
+
+				select {
+				case results <- item:
+					ack()
+				case <-done:
+					return
+				}
+			}
+		}()
+		return heartbeat
+	}
+
+	// flaky的前3个实例启动20ms后崩溃 OneForAll策略下每次都会重启正在处理值的ints
+	var flakyStarts int32
+	flaky := func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
+		heartbeat := make(chan interface{})
+		crash := atomic.AddInt32(&flakyStarts, 1) <= 3
+		go func() {
+			pulse := time.NewTicker(pulseInterval)
+			defer pulse.Stop()
+			crashed := time.After(20 * time.Millisecond)
+			for {
+				select {
+				case <-done:
+					return
+				case <-pulse.C:
+					sendPulse(heartbeat)
+				case <-crashed:
+					if crash {
+						close(heartbeat)
+						return
+					}
+				}
+			}
+		}()
+		return heartbeat
+	}
+
+	q := NewQuarantine(ctx, in, 2, nil)
+	NewSupervisor(Config{
+		Strategy:    OneForAll,
+		MaxRestarts: 10,
+		Window:      time.Minute,
+		Children: []ChildSpec{
+			{Name: "ints", Start: q.Wrap(ints), Timeout: testTimeout},
+			{Name: "flaky", Start: flaky, Timeout: testTimeout},
+		},
+	}).Start(done, time.Hour)
+
+	select {
+	case v := <-results:
+		if v != 1 {
+			t.Errorf("expected 1, but received %v", v)
+		}
+	case d := <-q.DeadLetters():
+		t.Fatalf("item restarted only because of a sibling was quarantined: %+v", d)
+	case <-time.After(2 * time.Second):
+		t.Fatal("test timed out")
+	}
+
+	if n := atomic.LoadInt32(&flakyStarts); n != 4 {
+		t.Errorf("expected flaky to be started 4 times, but started %v times", n)
+	}
+}
@@ -0,0 +1,330 @@
+// Package supervisor 将第5章中只能监控单个ward的steward扩展为仿照Erlang/OTP的监督树
+// 一个Supervisor管理多个子goroutine 按重启策略重启出现故障的子goroutine
+// 并且Supervisor本身也符合StartGoroutineFn的签名 因此可以作为另一个Supervisor的子goroutine 构成监督树
+package supervisor
+
+import (
+	"code/backoff"
+	"code/clock"
+	"fmt"
+	"time"
+)
+
+// StartGoroutineFn 启动被监控的goroutine 与第5章中的startGoroutineFn相同
+// 被监控的goroutine需要每隔pulseInterval通过heartbeat发送一次心跳 并在done关闭时退出
+type StartGoroutineFn func(done <-chan interface{}, pulseInterval time.Duration) (heartbeat <-chan interface{})
+
+// Exit 被监控的goroutine因故障退出时 可以在关闭heartbeat之前发送一个Exit 说明退出的原因
+// Supervisor将Err记录在HeartbeatMissed事件的Reason中
+type Exit struct {
+	Err error
+}
+
+// Strategy 子goroutine出现故障时的重启策略
+type Strategy int
+
+const (
+	// OneForOne 只重启出现故障的子goroutine
+	OneForOne Strategy = iota
+	// OneForAll 停止并重启所有子goroutine
+	OneForAll
+	// RestForOne 停止并重启出现故障的子goroutine 以及在它之后启动的所有子goroutine
+	RestForOne
+)
+
+// ChildSpec 描述一个被监控的子goroutine
+type ChildSpec struct {
+	Name    string
+	Start   StartGoroutineFn
+	Timeout time.Duration // 超过该时长未收到心跳则认为子goroutine不健康 子goroutine的心跳间隔为Timeout/2
+}
+
+// Config Supervisor的配置
+type Config struct {
+	Strategy Strategy
+	// MaxRestarts和Window 在Window时长内重启次数超过MaxRestarts时 Supervisor停止所有子goroutine并退出
+	// Supervisor退出时会关闭自己的heartbeat 使得上层Supervisor能够感知到故障 即故障向上升级
+	MaxRestarts int
+	Window      time.Duration
+	Children    []ChildSpec
+	// Backoff 子goroutine出现故障后 等待多久再重启 为nil时立即重启
+	// 每个子goroutine各自维护退避状态 OneForAll和RestForOne按出现故障的子goroutine的退避状态等待
+	Backoff *backoff.Policy
+	// ResetAfter 子goroutine在出现故障前已经持续运行了至少ResetAfter 则认为它曾经健康 将其退避状态重置
+	// 为0时退避状态永不重置
+	ResetAfter time.Duration
+	// Clock 为nil时使用clock.Real
+	Clock clock.Clock
+}
+
+// Supervisor 按Config中的策略监控并重启多个子goroutine
+type Supervisor struct {
+	config Config
+	clock  clock.Clock
+	events eventHub
+}
+
+func NewSupervisor(config Config) *Supervisor {
+	return &Supervisor{config: config, clock: clock.OrReal(config.Clock)}
+}
+
+// childEvent 由监控单个子goroutine的goroutine发出 表示该子goroutine出现了故障
+type childEvent struct {
+	index         int
+	generation    int // 子goroutine的第几次启动 用于丢弃已被停止的子goroutine发出的过期事件
+	reason        string
+	lastHeartbeat time.Time
+}
+
+// restartEvent 退避等待结束后发出 表示可以重启[first, last)范围内的子goroutine了
+type restartEvent struct {
+	id          int
+	first, last int
+}
+
+// child 记录一个子goroutine当前的运行状态
+type child struct {
+	spec       ChildSpec
+	wardDone   chan interface{} // 为nil表示该子goroutine已被停止
+	generation int
+	startedAt  time.Time
+	backoff    *backoff.Backoff
+	pendingID  int // 等待重启时对应的restartEvent的id 为0表示没有在等待重启
+
+	restarts      int       // 被重启的总次数
+	lastHeartbeat time.Time // 最后一次收到心跳的时刻 由出现故障时的childEvent带回
+	reason        string    // 最近一次被重启的原因
+}
+
+// Start 启动所有子goroutine并开始监控 本方法符合StartGoroutineFn的签名 因此Supervisor可以嵌套
+func (s *Supervisor) Start(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
+	heartbeat := make(chan interface{})
+
+	go func() {
+		defer close(heartbeat)
+
+		// quit 在Supervisor退出时关闭 用于通知仍在等待退避结束的goroutine
+		quit := make(chan interface{})
+		defer close(quit)
+
+		events := make(chan childEvent)
+		restartEvents := make(chan restartEvent)
+		children := make([]*child, len(s.config.Children))
+		for i, spec := range s.config.Children {
+			children[i] = &child{spec: spec}
+			if s.config.Backoff != nil {
+				children[i].backoff = backoff.New(*s.config.Backoff, nil)
+			}
+		}
+
+		for i := range children {
+			s.startChild(i, children[i], events)
+		}
+		defer s.stopChildren(children, true)
+
+		pulse := s.clock.NewTicker(pulseInterval)
+		defer pulse.Stop()
+
+		var restarts []time.Time
+		restartID := 0
+
+		for {
+			select {
+			case <-pulse.C():
+				sendPulse(heartbeat)
+			case event := <-events:
+				c := children[event.index]
+				if c.wardDone == nil || event.generation != c.generation {
+					continue
+				}
+
+				now := s.clock.Now()
+				c.lastHeartbeat = event.lastHeartbeat
+				s.publish(HeartbeatMissed, c, event.reason)
+
+				restarts = append(pruneRestarts(restarts, now, s.config.Window), now)
+				if len(restarts) > s.config.MaxRestarts {
+					s.publish(WardGaveUp, c, fmt.Sprintf("more than %d restarts within %v", s.config.MaxRestarts, s.config.Window))
+					return
+				}
+
+				first, last := s.restartRange(event.index, len(children))
+				s.stopChildren(children[first:last], false)
+				for i := first; i < last; i++ {
+					children[i].reason = event.reason
+					if i != event.index {
+						children[i].reason = fmt.Sprintf("%s failed: %s", c.spec.Name, event.reason)
+					}
+				}
+
+				delay := s.restartDelay(c, now)
+				if delay <= 0 {
+					for i := first; i < last; i++ {
+						s.startChild(i, children[i], events)
+					}
+					continue
+				}
+
+				restartID++
+				for i := first; i < last; i++ {
+					children[i].pendingID = restartID
+				}
+				go s.waitRestart(delay, restartEvent{id: restartID, first: first, last: last}, restartEvents, quit)
+			case event := <-restartEvents:
+				for i := event.first; i < event.last; i++ {
+					// 等待期间该子goroutine可能因其他子goroutine的故障被纳入了新的重启 此时以新的重启为准
+					if children[i].pendingID == event.id {
+						s.startChild(i, children[i], events)
+					}
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return heartbeat
+}
+
+// restartRange 根据重启策略 返回第index个子goroutine出现故障时需要重启的子goroutine的下标范围[first, last)
+func (s *Supervisor) restartRange(index int, count int) (first, last int) {
+	switch s.config.Strategy {
+	case OneForAll:
+		return 0, count
+	case RestForOne:
+		return index, count
+	default:
+		return index, index + 1
+	}
+}
+
+// restartDelay 返回子goroutine c在now时刻出现故障后 需要等待多久再重启
+func (s *Supervisor) restartDelay(c *child, now time.Time) time.Duration {
+	if c.backoff == nil {
+		return 0
+	}
+
+	if s.config.ResetAfter > 0 && now.Sub(c.startedAt) >= s.config.ResetAfter {
+		c.backoff.Reset()
+	}
+	return c.backoff.Next()
+}
+
+// waitRestart 等待delay后将event发送给Supervisor
+func (s *Supervisor) waitRestart(delay time.Duration, event restartEvent, restartEvents chan<- restartEvent, quit <-chan interface{}) {
+	timer := s.clock.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+	case <-quit:
+		return
+	}
+
+	select {
+	case restartEvents <- event:
+	case <-quit:
+	}
+}
+
+// startChild 启动第index个子goroutine 并启动一个goroutine监控它的心跳
+func (s *Supervisor) startChild(index int, c *child, events chan<- childEvent) {
+	c.generation++
+	c.pendingID = 0
+	c.startedAt = s.clock.Now()
+	c.lastHeartbeat = c.startedAt
+	c.wardDone = make(chan interface{})
+	wardHeartbeat := c.spec.Start(c.wardDone, c.spec.Timeout/2)
+
+	if c.generation == 1 {
+		s.publish(WardStarted, c, "")
+	} else {
+		c.restarts++
+		s.publish(WardRestarted, c, c.reason)
+	}
+
+	go s.watch(c.wardDone, wardHeartbeat, c.spec.Timeout, events, childEvent{index: index, generation: c.generation})
+}
+
+// stopChildren 按启动顺序的逆序停止children中的所有子goroutine
+// final为true表示Supervisor即将退出 此时为每个被停止的子goroutine发布WardStopped事件
+func (s *Supervisor) stopChildren(children []*child, final bool) {
+	for i := len(children) - 1; i >= 0; i-- {
+		if children[i].wardDone != nil {
+			close(children[i].wardDone)
+			children[i].wardDone = nil
+			if final {
+				s.publish(WardStopped, children[i], "supervisor stopped")
+			}
+		}
+	}
+}
+
+func (s *Supervisor) publish(kind EventKind, c *child, reason string) {
+	s.events.publish(Event{
+		Kind:          kind,
+		Ward:          c.spec.Name,
+		Time:          s.clock.Now(),
+		RestartCount:  c.restarts,
+		LastHeartbeat: c.lastHeartbeat,
+		Reason:        reason,
+	})
+}
+
+// watch 监控一个子goroutine的心跳 超时或心跳channel被关闭时 向events发送一个事件后退出
+func (s *Supervisor) watch(wardDone <-chan interface{}, wardHeartbeat <-chan interface{}, timeout time.Duration, events chan<- childEvent, event childEvent) {
+	timeoutSignal := s.clock.NewTimer(timeout)
+	defer timeoutSignal.Stop()
+
+	event.lastHeartbeat = s.clock.Now()
+	var exit error
+	for {
+		select {
+		case pulse, ok := <-wardHeartbeat:
+			if !ok {
+				event.reason = "ward exited"
+				if exit != nil {
+					event.reason = fmt.Sprintf("ward exited: %v", exit)
+				}
+				break
+			}
+
+			if e, isExit := pulse.(Exit); isExit {
+				exit = e.Err
+			}
+
+			event.lastHeartbeat = s.clock.Now()
+			if !timeoutSignal.Stop() {
+				<-timeoutSignal.C()
+			}
+			timeoutSignal.Reset(timeout)
+			continue
+		case <-timeoutSignal.C():
+			event.reason = "heartbeat missed"
+		case <-wardDone:
+			return
+		}
+
+		select {
+		case events <- event:
+		case <-wardDone:
+		}
+		return
+	}
+}
+
+// pruneRestarts 丢弃restarts中早于now-window的重启记录
+func pruneRestarts(restarts []time.Time, now time.Time, window time.Duration) []time.Time {
+	i := 0
+	for i < len(restarts) && now.Sub(restarts[i]) > window {
+		i++
+	}
+	return restarts[i:]
+}
+
+func sendPulse(heartbeat chan interface{}) {
+	select {
+	case heartbeat <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,216 @@
+package supervisor
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testTimeout = 50 * time.Millisecond
+
+// healthyWard 返回一个一直正常发送心跳的ward 并通过starts记录其被启动的次数
+func healthyWard(starts *int32) StartGoroutineFn {
+	return func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
+		atomic.AddInt32(starts, 1)
+		heartbeat := make(chan interface{})
+
+		go func() {
+			pulse := time.NewTicker(pulseInterval)
+			defer pulse.Stop()
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-pulse.C:
+					sendPulse(heartbeat)
+				}
+			}
+		}()
+
+		return heartbeat
+	}
+}
+
+// crashingWard 返回一个在前crashes次启动时立即退出(关闭心跳)的ward 之后的启动均正常工作
+func crashingWard(starts *int32, crashes int32) StartGoroutineFn {
+	healthy := healthyWard(new(int32))
+	return func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
+		if atomic.AddInt32(starts, 1) <= crashes {
+			heartbeat := make(chan interface{})
+			close(heartbeat)
+			return heartbeat
+		}
+		return healthy(done, pulseInterval)
+	}
+}
+
+// silentWard 返回一个从不发送心跳的ward 用于模拟卡住的goroutine
+func silentWard(starts *int32) StartGoroutineFn {
+	return func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
+		atomic.AddInt32(starts, 1)
+		return make(chan interface{})
+	}
+}
+
+func waitFor(t *testing.T, desc string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", desc)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func load(counter *int32) int32 {
+	return atomic.LoadInt32(counter)
+}
+
+func TestSupervisor_OneForOneRestartsOnlyFailedChild(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	var healthyStarts, crashingStarts int32
+	NewSupervisor(Config{
+		Strategy:    OneForOne,
+		MaxRestarts: 5,
+		Window:      time.Second,
+		Children: []ChildSpec{
+			{Name: "healthy", Start: healthyWard(&healthyStarts), Timeout: testTimeout},
+			{Name: "crashing", Start: crashingWard(&crashingStarts, 2), Timeout: testTimeout},
+		},
+	}).Start(done, testTimeout)
+
+	waitFor(t, "crashing ward to be restarted", func() bool { return load(&crashingStarts) == 3 })
+	time.Sleep(2 * testTimeout)
+
+	if n := load(&healthyStarts); n != 1 {
+		t.Errorf("expected healthy ward to be started once, but started %v times", n)
+	}
+	if n := load(&crashingStarts); n != 3 {
+		t.Errorf("expected crashing ward to be started 3 times, but started %v times", n)
+	}
+}
+
+func TestSupervisor_OneForAllRestartsAllChildren(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	var healthyStarts, crashingStarts int32
+	NewSupervisor(Config{
+		Strategy:    OneForAll,
+		MaxRestarts: 5,
+		Window:      time.Second,
+		Children: []ChildSpec{
+			{Name: "healthy", Start: healthyWard(&healthyStarts), Timeout: testTimeout},
+			{Name: "crashing", Start: crashingWard(&crashingStarts, 1), Timeout: testTimeout},
+		},
+	}).Start(done, testTimeout)
+
+	waitFor(t, "all wards to be restarted", func() bool {
+		return load(&healthyStarts) == 2 && load(&crashingStarts) == 2
+	})
+}
+
+func TestSupervisor_RestForOneRestartsLaterChildren(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	var firstStarts, crashingStarts, lastStarts int32
+	NewSupervisor(Config{
+		Strategy:    RestForOne,
+		MaxRestarts: 5,
+		Window:      time.Second,
+		Children: []ChildSpec{
+			{Name: "first", Start: healthyWard(&firstStarts), Timeout: testTimeout},
+			{Name: "crashing", Start: crashingWard(&crashingStarts, 1), Timeout: testTimeout},
+			{Name: "last", Start: healthyWard(&lastStarts), Timeout: testTimeout},
+		},
+	}).Start(done, testTimeout)
+
+	waitFor(t, "crashing and later wards to be restarted", func() bool {
+		return load(&crashingStarts) == 2 && load(&lastStarts) == 2
+	})
+	time.Sleep(2 * testTimeout)
+
+	if n := load(&firstStarts); n != 1 {
+		t.Errorf("expected first ward to be started once, but started %v times", n)
+	}
+}
+
+func TestSupervisor_RestartsWardThatMissesHeartbeat(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	var starts int32
+	NewSupervisor(Config{
+		MaxRestarts: 10,
+		Window:      time.Second,
+		Children:    []ChildSpec{{Name: "silent", Start: silentWard(&starts), Timeout: testTimeout}},
+	}).Start(done, testTimeout)
+
+	waitFor(t, "silent ward to be restarted", func() bool { return load(&starts) >= 2 })
+}
+
+func TestSupervisor_GivesUpAfterMaxRestarts(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	var starts int32
+	heartbeat := NewSupervisor(Config{
+		MaxRestarts: 3,
+		Window:      time.Minute,
+		Children:    []ChildSpec{{Name: "crashing", Start: crashingWard(&starts, 100), Timeout: testTimeout}},
+	}).Start(done, testTimeout)
+
+	for {
+		select {
+		case _, ok := <-heartbeat:
+			if ok {
+				continue
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("test timed out")
+		}
+		break
+	}
+
+	// 首次启动1次 加上3次重启
+	if n := load(&starts); n != 4 {
+		t.Errorf("expected ward to be started 4 times, but started %v times", n)
+	}
+}
+
+func TestSupervisor_NestedSupervisorEscalatesFailure(t *testing.T) {
+	done := make(chan interface{})
+	defer close(done)
+
+	var crashingStarts, siblingStarts int32
+	// 内层Supervisor不允许重启 子goroutine第1次崩溃时内层Supervisor即退出 由外层Supervisor重启整个子树
+	inner := NewSupervisor(Config{
+		Strategy: OneForAll,
+		Children: []ChildSpec{
+			{Name: "crashing", Start: crashingWard(&crashingStarts, 1), Timeout: testTimeout},
+			{Name: "sibling", Start: healthyWard(&siblingStarts), Timeout: testTimeout},
+		},
+	})
+
+	var innerStarts int32
+	startInner := func(done <-chan interface{}, pulseInterval time.Duration) <-chan interface{} {
+		atomic.AddInt32(&innerStarts, 1)
+		return inner.Start(done, pulseInterval)
+	}
+
+	NewSupervisor(Config{
+		MaxRestarts: 5,
+		Window:      time.Second,
+		Children:    []ChildSpec{{Name: "inner", Start: startInner, Timeout: 4 * testTimeout}},
+	}).Start(done, testTimeout)
+
+	waitFor(t, "subtree to be restarted", func() bool {
+		return load(&innerStarts) == 2 && load(&siblingStarts) == 2 && load(&crashingStarts) == 2
+	})
+}